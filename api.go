@@ -1,64 +1,211 @@
 package playstation
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"time"
+	"net/url"
 )
 
-// request sends an HTTP GET request to the specified URL using the provided tokens for authentication.
+// apiRequest describes a request sent to the PlayStation API.
+//
+// Fields:
+//
+//	method (string): The HTTP method of the request.
+//	url (string): The URL to which the request is sent, possibly with a query string.
+//	query (url.Values): The query parameters added to the URL, may be nil.
+//	body (interface{}): The value sent as a JSON body, nil for requests without body.
+//	noCache (bool): Whether the response must not be cached, even if the Client has a cache.
+type apiRequest struct {
+	method  string
+	url     string
+	query   url.Values
+	body    interface{}
+	noCache bool
+}
+
+// apiResponse describes a successful response of the PlayStation API.
+//
+// Fields:
+//
+//	status (int): The HTTP status code of the response.
+//	header (http.Header): The headers of the response.
+//	body ([]byte): The response body.
+type apiResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// fullURL returns the URL of the request with its query parameters.
+//
+// Returns:
+//
+//	string: The URL to which the request is sent.
+//	error: An error if the URL cannot be parsed.
+func (r apiRequest) fullURL() (string, error) {
+	if len(r.query) == 0 {
+		return r.url, nil
+	}
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return "", fmt.Errorf("error parsing url: %w", err)
+	}
+	query := u.Query()
+	for key, values := range r.query {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// host returns the host the request is sent to.
+func (r apiRequest) host() string {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// send sends the request to the PlayStation API using the tokens of the session for authentication.
 // It handles the creation of the request, adding necessary headers, sending the request, and processing the response.
+// Failed idempotent requests are retried according to the RetryPolicy of the Client, GET responses are
+// cached if the Client has a cache, and identical GET requests made at the same time are sent once.
 //
 // Parameters:
 //
 //	ctx (context.Context): The context for controlling the request lifetime.
-//	tokens (*Tokens): The tokens used for authentication, must contain a valid access token.
-//	url (string): The URL to which the request is sent.
+//	req (apiRequest): The request to be sent.
 //
 // Returns:
 //
-//	[]byte: The response body as a byte slice if the request is successful.
-//	error: An error indicating whether the request was successful or not.
-func (c *ClientAPI) request(ctx context.Context, url string) ([]byte, error) {
-	if c.Tokens == nil || c.Tokens.AccessToken == "" {
-		return nil, errors.New("invalid tokens: access token is required")
+//	[]byte: The response body as a byte slice if the request is successful, empty for 204 No Content responses.
+//	error: An error indicating whether the request was successful or not, an *APIError if PSN answered with an error.
+func (c *ClientAPI) send(ctx context.Context, req apiRequest) ([]byte, error) {
+	endpoint, err := req.fullURL()
+	if err != nil {
+		return nil, err
 	}
 
-	//TODO: Implement token refresh logic without using npsso (with storing refresh token)
-	if c.Tokens.AccessExpiresTime.Before(time.Now()) {
-		newTokens, err := c.Client.authRequest(ctx, c.NPSSO)
+	if req.method == http.MethodGet {
+		key := Operation(ctx) + " " + endpoint
+		return c.flights.do(ctx, key, func() ([]byte, error) {
+			if ttl := c.cacheTTL(ctx, req); ttl > 0 {
+				return c.sendCached(ctx, req, endpoint, ttl)
+			}
+			resp, err := c.sendWithRetry(ctx, req, endpoint, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			return resp.body, nil
+		})
+	}
+
+	var payload []byte
+	if req.body != nil {
+		payload, err = json.Marshal(req.body)
 		if err != nil {
-			return nil, fmt.Errorf("error refreshing tokens: %w", err)
+			return nil, fmt.Errorf("error encoding request body: %w", err)
+		}
+	}
+
+	resp, err := c.sendWithRetry(ctx, req, endpoint, payload, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+// sendWithRetry sends the request, retrying failed idempotent requests according to the RetryPolicy of the Client.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the request lifetime.
+//	req (apiRequest): The request to be sent.
+//	endpoint (string): The URL to which the request is sent, with its query parameters.
+//	payload ([]byte): The JSON body of the request, nil for requests without body.
+//	header (http.Header): The conditional headers of the request, nil for unconditional requests.
+//
+// Returns:
+//
+//	*apiResponse: The response if the request is successful, or not modified for conditional requests.
+//	error: An error indicating whether the request was successful or not, an *APIError if PSN answered with an error.
+func (c *ClientAPI) sendWithRetry(ctx context.Context, req apiRequest, endpoint string, payload []byte, header http.Header) (*apiResponse, error) {
+	for retry := 1; ; retry++ {
+		resp, err := c.sendOnce(ctx, req.method, endpoint, payload, header)
+		if err == nil {
+			return resp, nil
+		}
+
+		delay, ok := c.Client.retry.retryDelay(ctx, req.method, err, retry)
+		if !ok {
+			return nil, err
+		}
+		if c.Client.metrics != nil {
+			c.Client.metrics.IncRetry(req.host(), Operation(ctx))
+		}
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return nil, err
 		}
-		c.Tokens = newTokens
+	}
+}
+
+// sendOnce makes a single attempt of a request sent by send.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the request lifetime.
+//	method (string): The HTTP method of the request.
+//	endpoint (string): The URL to which the request is sent.
+//	payload ([]byte): The JSON body of the request, nil for requests without body.
+//	header (http.Header): The conditional headers of the request, nil for unconditional requests.
+//
+// Returns:
+//
+//	*apiResponse: The response if the request is successful, or 304 Not Modified for conditional requests.
+//	error: An error indicating whether the request was successful or not, an *APIError if PSN answered with an error.
+func (c *ClientAPI) sendOnce(ctx context.Context, method string, endpoint string, payload []byte, header http.Header) (*apiResponse, error) {
+	accessToken, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create new request with context
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	// Add headers
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Tokens.AccessToken))
-	req.Header.Set("Accept", "application/json")
-	if c.Client.lang != "" {
-		req.Header.Set("Accept-Language", string(c.Client.lang))
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	setAuthHeaders(req, accessToken, c.Client.lang)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
 	// Send request
-	resp, err := c.Client.httpClient.Do(req)
+	resp, err := c.Client.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
-		if err != nil {
-			fmt.Println("Error closing body")
+		if err != nil && c.Client.logger != nil {
+			c.Client.logger.WarnContext(ctx, "error closing response body", slog.String("error", err.Error()))
 		}
 	}(resp.Body)
 
@@ -68,45 +215,36 @@ func (c *ClientAPI) request(ctx context.Context, url string) ([]byte, error) {
 		return nil, fmt.Errorf("error reading response body: %w", err)
 	}
 
-	// Handle different status codes
-	switch resp.StatusCode {
-	case http.StatusOK:
-		return body, nil
-		//case http.StatusUnauthorized:
-		//	return nil, fmt.Errorf("unauthorized: invalid or expired token")
-		//case http.StatusForbidden:
-		//	return nil, fmt.Errorf("forbidden: insufficient permissions")
-	case http.StatusUnauthorized:
-		return body, nil
-	case http.StatusForbidden:
-		return body, nil
-	case http.StatusNotFound:
-		return nil, fmt.Errorf("resource not found: %s", url)
-	case http.StatusTooManyRequests:
-		return nil, fmt.Errorf("rate limit exceeded")
-	default:
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	// Every status other than 2xx is an API error, except 304 for conditional requests
+	notModified := resp.StatusCode == http.StatusNotModified && header != nil
+	if !notModified && (resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices) {
+		apiErr := newAPIError(resp.StatusCode, endpoint, body)
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		return nil, apiErr
 	}
+	return &apiResponse{status: resp.StatusCode, header: resp.Header, body: body}, nil
 }
 
-// requestAndUnmarshal sends an HTTP GET request to the specified URL using the provided tokens for authentication,
-// and unmarshals the response body into the provided interface.
+// sendAndUnmarshal sends the request to the PlayStation API and unmarshals the response body into the provided interface.
+// Responses without body, such as 204 No Content, leave v untouched.
 //
 // Parameters:
 //
 //	ctx (context.Context): The context for controlling the request lifetime.
-//	tokens (*Tokens): The tokens used for authentication, must contain a valid access token.
-//	url (string): The URL to which the request is sent.
-//	v (interface{}): The interface into which the response body is unmarshaled.
+//	req (apiRequest): The request to be sent.
+//	v (interface{}): The interface into which the response body is unmarshaled, may be nil to ignore the body.
 //
 // Returns:
 //
-//	error: An error indicating whether the request or unmarshaling was successful or not.
-func (c *ClientAPI) requestAndUnmarshal(ctx context.Context, url string, v interface{}) error {
-	body, err := c.request(ctx, url)
+//	error: An error indicating whether the request or unmarshaling was successful or not, an *APIError if PSN answered with an error.
+func (c *ClientAPI) sendAndUnmarshal(ctx context.Context, req apiRequest, v interface{}) error {
+	body, err := c.send(ctx, req)
 	if err != nil {
 		return err
 	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
 
 	var requestError RequestError
 	if err := json.Unmarshal(body, &requestError); err != nil {
@@ -114,9 +252,14 @@ func (c *ClientAPI) requestAndUnmarshal(ctx context.Context, url string, v inter
 	}
 
 	if requestError.Error.Code != 0 {
-		return fmt.Errorf("request error: %s", requestError.Error.Message)
+		// send already parsed the URL, so it cannot fail here
+		endpoint, _ := req.fullURL()
+		return newAPIError(http.StatusOK, endpoint, body)
 	}
 
+	if v == nil {
+		return nil
+	}
 	if err := json.Unmarshal(body, v); err != nil {
 		return fmt.Errorf("error unmarshaling response: %w, body: %s", err, string(body))
 	}
@@ -124,6 +267,42 @@ func (c *ClientAPI) requestAndUnmarshal(ctx context.Context, url string, v inter
 	return nil
 }
 
+// request sends an HTTP GET request to the specified URL using the tokens of the session for authentication.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the request lifetime.
+//	url (string): The URL to which the request is sent.
+//
+// Returns:
+//
+//	[]byte: The response body as a byte slice if the request is successful.
+//	error: An error indicating whether the request was successful or not, an *APIError if PSN answered with an error.
+func (c *ClientAPI) request(ctx context.Context, url string) ([]byte, error) {
+	return c.send(ctx, apiRequest{method: http.MethodGet, url: url})
+}
+
+// sendJSON sends the request to the PlayStation API and unmarshals the response body into a new value of type T,
+// so each endpoint only has to name its response type.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the request lifetime.
+//	c (*ClientAPI): The session the request is sent with.
+//	req (apiRequest): The request to be sent.
+//
+// Returns:
+//
+//	*T: A pointer to the unmarshaled response, left zero for responses without body.
+//	error: An error indicating whether the request or unmarshaling was successful or not, an *APIError if PSN answered with an error.
+func sendJSON[T any](ctx context.Context, c *ClientAPI, req apiRequest) (*T, error) {
+	var response T
+	if err := c.sendAndUnmarshal(ctx, req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
 // GetUserAccountId retrieves the user account ID and other details for the specified online ID.
 //
 // Parameters:
@@ -136,14 +315,10 @@ func (c *ClientAPI) requestAndUnmarshal(ctx context.Context, url string, v inter
 //	*UserAccountResponse: A pointer to the UserAccountResponse containing the user's account details.
 //	error: An error indicating whether the request was successful or not.
 func (c *ClientAPI) GetUserAccountId(ctx context.Context, onlineId string) (*UserAccountResponse, error) {
-	url := fmt.Sprintf("https://us-prof.np.community.playstation.net/userProfile/v1/users/%s/profile2?fields=accountId,onlineId,currentOnlineId", onlineId)
-
-	var response UserAccountResponse
-	if err := c.requestAndUnmarshal(ctx, url, &response); err != nil {
-		return nil, err
-	}
+	ctx = withOperation(ctx, "GetUserAccountId")
+	url := fmt.Sprintf("%s/userProfile/v1/users/%s/profile2?fields=accountId,onlineId,currentOnlineId", c.Client.endpoints.LegacyProfile, onlineId)
 
-	return &response, nil
+	return sendJSON[UserAccountResponse](ctx, c, apiRequest{method: http.MethodGet, url: url})
 }
 
 // GetUserProfile retrieves the user profile details for the specified account ID.
@@ -158,14 +333,10 @@ func (c *ClientAPI) GetUserAccountId(ctx context.Context, onlineId string) (*Use
 //	*UserProfileResponse: A pointer to the UserProfileResponse containing the user's profile details.
 //	error: An error indicating whether the request was successful or not.
 func (c *ClientAPI) GetUserProfile(ctx context.Context, accountId string) (*UserProfileResponse, error) {
-	url := fmt.Sprintf("https://m.np.playstation.com/api/userProfile/v1/internal/users/%s/profiles", accountId)
-
-	var response UserProfileResponse
-	if err := c.requestAndUnmarshal(ctx, url, &response); err != nil {
-		return nil, err
-	}
+	ctx = withOperation(ctx, "GetUserProfile")
+	url := fmt.Sprintf("%s/userProfile/v1/internal/users/%s/profiles", c.Client.endpoints.MobileAPI, accountId)
 
-	return &response, nil
+	return sendJSON[UserProfileResponse](ctx, c, apiRequest{method: http.MethodGet, url: url})
 }
 
 // GetUserGames retrieves the list of games for the specified account ID.
@@ -180,12 +351,41 @@ func (c *ClientAPI) GetUserProfile(ctx context.Context, accountId string) (*User
 //	*UserGamesResponse: A pointer to the UserGamesResponse containing the user's game list.
 //	error: An error indicating whether the request was successful or not.
 func (c *ClientAPI) GetUserGames(ctx context.Context, accountId string) (*UserGamesResponse, error) {
-	url := fmt.Sprintf("https://m.np.playstation.com/api/gamelist/v2/users/%s/titles?limit=10", accountId)
+	ctx = withOperation(ctx, "GetUserGames")
+	url := fmt.Sprintf("%s/gamelist/v2/users/%s/titles?limit=10", c.Client.endpoints.MobileAPI, accountId)
+
+	return sendJSON[UserGamesResponse](ctx, c, apiRequest{method: http.MethodGet, url: url})
+}
+
+// Validate checks that the session still works by retrieving the account it is authenticated as.
+// It refreshes the tokens first if needed, and makes a single cheap request.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the request lifetime.
+//
+// Returns:
+//
+//	*SessionInfo: A pointer to the SessionInfo containing the account ID and online ID of the session.
+//	error: An error wrapping ErrSessionInvalid if the session is dead or its access token is rejected with a 401,
+//	or another error if it could not be checked, for example because PSN is unavailable or the scopes of the session
+//	do not allow the request.
+func (c *ClientAPI) Validate(ctx context.Context) (*SessionInfo, error) {
+	ctx = withOperation(ctx, "Validate")
+	url := c.Client.endpoints.LegacyProfile + "/userProfile/v1/users/me/profile2?fields=accountId,onlineId"
 
-	var response UserGamesResponse
-	if err := c.requestAndUnmarshal(ctx, url, &response); err != nil {
+	// Validate checks the session against PSN, so its response is never cached
+	var response UserAccountResponse
+	if err := c.sendAndUnmarshal(ctx, apiRequest{method: http.MethodGet, url: url, noCache: true}, &response); err != nil {
+		// A 403 means that the scopes of the session do not allow the request, not that the session is dead
+		if isSessionError(err) && !errors.Is(err, ErrSessionInvalid) {
+			return nil, fmt.Errorf("%w: %w", ErrSessionInvalid, err)
+		}
 		return nil, err
 	}
 
-	return &response, nil
+	return &SessionInfo{
+		AccountID: response.Profile.AccountID,
+		OnlineID:  response.Profile.OnlineID,
+	}, nil
 }
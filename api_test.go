@@ -0,0 +1,133 @@
+package playstation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateSessionErrors(t *testing.T) {
+	tests := []struct {
+		status  int
+		invalid bool
+	}{
+		{http.StatusUnauthorized, true},
+		{http.StatusForbidden, false},
+		{http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			session := newTestSession(t, client, testTokens(true))
+
+			_, err := session.Validate(context.Background())
+			if err == nil {
+				t.Fatal("Validate succeeded, want an error")
+			}
+			if got := errors.Is(err, ErrSessionInvalid); got != tt.invalid {
+				t.Fatalf("Validate = %v, ErrSessionInvalid %t, want %t", err, got, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAccount(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"profile":{"accountId":"42","onlineId":"player"}}`))
+	}))
+	session := newTestSession(t, client, testTokens(true))
+
+	info, err := session.Validate(context.Background())
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if info.AccountID != "42" || info.OnlineID != "player" {
+		t.Fatalf("Validate = %+v, want account 42 and online ID player", info)
+	}
+}
+
+func TestSendJSONBody(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" ||
+			json.NewDecoder(r.Body).Decode(&body) != nil || body["message"] != "hello" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"onlineId":"` + r.URL.RawQuery + `"}`))
+	}))
+	session := newTestSession(t, client, testTokens(true))
+
+	profile, err := sendJSON[UserProfileResponse](context.Background(), session, apiRequest{
+		method: http.MethodPost,
+		url:    client.endpoints.MobileAPI + "/messages?limit=10",
+		query:  url.Values{"offset": {"20"}},
+		body:   map[string]string{"message": "hello"},
+	})
+	if err != nil {
+		t.Fatalf("sendJSON: %v", err)
+	}
+	if profile.OnlineID != "limit=10&offset=20" {
+		t.Fatalf("query = %q, want limit=10&offset=20", profile.OnlineID)
+	}
+}
+
+func TestSendNoContentLeavesValue(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	session := newTestSession(t, client, testTokens(true))
+
+	profile := UserProfileResponse{OnlineID: "unchanged"}
+	req := apiRequest{method: http.MethodDelete, url: client.endpoints.MobileAPI + "/messages/1"}
+	if err := session.sendAndUnmarshal(context.Background(), req, &profile); err != nil {
+		t.Fatalf("sendAndUnmarshal: %v", err)
+	}
+	if profile.OnlineID != "unchanged" {
+		t.Fatalf("online ID = %q, want unchanged", profile.OnlineID)
+	}
+}
+
+func TestSendSkipsCoalescingAndCacheForNonGET(t *testing.T) {
+	var requests int32
+	both := make(chan struct{})
+	client := newCacheTestClient(t, NewLRUCache(10), time.Minute, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 2 {
+			close(both)
+		}
+		// Coalesced requests would only reach the server once
+		select {
+		case <-both:
+		case <-time.After(5 * time.Second):
+		}
+		w.Write([]byte(`{}`))
+	})
+	session := newTestSession(t, client, testAccountTokens("1"))
+	req := apiRequest{method: http.MethodPost, url: client.endpoints.MobileAPI + "/messages", body: struct{}{}}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := session.send(context.Background(), req)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if _, err := session.send(context.Background(), req); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Fatalf("requests = %d, want 3", got)
+	}
+}
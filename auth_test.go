@@ -0,0 +1,430 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newAuthTestClient creates a Client whose authorize endpoint issues a code naming the first letter of the NPSSO token,
+// and whose token endpoint returns an access token holding the code, or the refresh token for the refresh grant.
+func newAuthTestClient(t *testing.T, authorizations *int32, opts ...Options) *Client {
+	t.Helper()
+	return newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/authorize"):
+			atomic.AddInt32(authorizations, 1)
+			cookie, err := r.Cookie("npsso")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Location", "com.scee.psxandroid.scecompcall://redirect?code=v3."+cookie.Value[:1])
+			w.WriteHeader(http.StatusFound)
+		case strings.HasSuffix(r.URL.Path, "/token"):
+			if err := r.ParseForm(); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if refreshToken := r.Form.Get("refresh_token"); refreshToken != "" {
+				writeTokenResponse(w, "access-"+refreshToken, refreshToken)
+				return
+			}
+			writeTokenResponse(w, "access-"+r.Form.Get("code"), "refresh-"+r.Form.Get("code"))
+		}
+	}), opts...)
+}
+
+func TestAuthenticateResumesOnlySameNPSSO(t *testing.T) {
+	ctx := context.Background()
+	var authorizations int32
+	store := NewMemoryTokenStore()
+	client := newAuthTestClient(t, &authorizations, mustOption(WithTokenStore(store)))
+	npssoA, npssoB := strings.Repeat("a", 64), strings.Repeat("b", 64)
+
+	if _, err := client.Authenticate(ctx, npssoA); err != nil {
+		t.Fatalf("Authenticate(A): %v", err)
+	}
+	session, err := client.Authenticate(ctx, npssoA)
+	if err != nil {
+		t.Fatalf("Authenticate(A) again: %v", err)
+	}
+	if got := atomic.LoadInt32(&authorizations); got != 1 {
+		t.Fatalf("authorizations = %d, want 1", got)
+	}
+	if got := session.CurrentTokens().AccessToken; got != "access-v3.a" {
+		t.Fatalf("resumed access token = %q, want access-v3.a", got)
+	}
+
+	session, err = client.Authenticate(ctx, npssoB)
+	if err != nil {
+		t.Fatalf("Authenticate(B): %v", err)
+	}
+	if got := atomic.LoadInt32(&authorizations); got != 2 {
+		t.Fatalf("authorizations = %d, want 2", got)
+	}
+	if got := session.CurrentTokens().AccessToken; got != "access-v3.b" {
+		t.Fatalf("access token = %q, want access-v3.b", got)
+	}
+	stored, err := store.Load(ctx)
+	if err != nil || stored.Tokens.AccessToken != "access-v3.b" {
+		t.Fatalf("stored tokens = %+v, %v", stored, err)
+	}
+	if npsso, err := store.LoadNPSSO(ctx); err != nil || npsso != npssoB {
+		t.Fatalf("stored npsso = %q, %v", npsso, err)
+	}
+}
+
+func TestAuthenticateWithTokensIgnoresNPSSOOfOtherAccount(t *testing.T) {
+	ctx := context.Background()
+	var authorizations int32
+	store := NewMemoryTokenStore()
+	client := newAuthTestClient(t, &authorizations, mustOption(WithTokenStore(store)))
+	if _, err := client.Authenticate(ctx, strings.Repeat("a", 64)); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	other := &Tokens{
+		AccessToken:       "access-other",
+		RefreshToken:      "refresh-other",
+		AccessExpiresTime: time.Now().Add(time.Hour),
+	}
+	session, err := client.AuthenticateWithTokens(ctx, other, "")
+	if err != nil {
+		t.Fatalf("AuthenticateWithTokens: %v", err)
+	}
+	if session.NPSSO != "" {
+		t.Fatal("session of another account got the stored npsso")
+	}
+	if _, err := store.LoadNPSSO(ctx); err == nil {
+		t.Fatal("npsso of another account left in the store")
+	}
+}
+
+func TestSessionKeepsStoreOfOtherAccount(t *testing.T) {
+	ctx := context.Background()
+	var authorizations int32
+	store := NewMemoryTokenStore()
+	client := newAuthTestClient(t, &authorizations, mustOption(WithTokenStore(store)))
+	npssoA, npssoB := strings.Repeat("a", 64), strings.Repeat("b", 64)
+
+	sessionA, err := client.Authenticate(ctx, npssoA)
+	if err != nil {
+		t.Fatalf("Authenticate(A): %v", err)
+	}
+	if _, err := client.Authenticate(ctx, npssoB); err != nil {
+		t.Fatalf("Authenticate(B): %v", err)
+	}
+
+	sessionA.Tokens.AccessExpiresTime = time.Now().Add(-time.Minute)
+	if token, err := sessionA.Token(ctx); err != nil || token != "access-refresh-v3.a" {
+		t.Fatalf("refreshed token of A = %q, %v", token, err)
+	}
+	if stored, err := store.Load(ctx); err != nil || stored.Tokens.AccessToken != "access-v3.b" {
+		t.Fatalf("stored tokens after refresh of A = %+v, %v", stored, err)
+	}
+
+	session, err := client.Authenticate(ctx, npssoB)
+	if err != nil {
+		t.Fatalf("Authenticate(B) again: %v", err)
+	}
+	if got := session.CurrentTokens().AccessToken; got != "access-v3.b" {
+		t.Fatalf("resumed access token of B = %q, want access-v3.b", got)
+	}
+	if got := atomic.LoadInt32(&authorizations); got != 2 {
+		t.Fatalf("authorizations = %d, want 2", got)
+	}
+
+	if err := sessionA.Logout(ctx); err != nil {
+		t.Fatalf("Logout(A): %v", err)
+	}
+	if stored, err := store.Load(ctx); err != nil || stored.Tokens.AccessToken != "access-v3.b" {
+		t.Fatalf("stored tokens after logout of A = %+v, %v", stored, err)
+	}
+
+	if err := session.Logout(ctx); err != nil {
+		t.Fatalf("Logout(B): %v", err)
+	}
+	if _, err := store.Load(ctx); err != ErrTokensNotFound {
+		t.Fatalf("stored tokens after logout of B: %v, want ErrTokensNotFound", err)
+	}
+}
+
+func TestAuthenticateWithCodeForgetsNPSSOOfOtherAccount(t *testing.T) {
+	ctx := context.Background()
+	var authorizations int32
+	store := NewMemoryTokenStore()
+	client := newAuthTestClient(t, &authorizations, mustOption(WithTokenStore(store)))
+	npssoA := strings.Repeat("a", 64)
+
+	if _, err := client.Authenticate(ctx, npssoA); err != nil {
+		t.Fatalf("Authenticate(A): %v", err)
+	}
+	if _, err := client.AuthenticateWithCode(ctx, "v3.z"); err != nil {
+		t.Fatalf("AuthenticateWithCode: %v", err)
+	}
+	if _, err := store.LoadNPSSO(ctx); err == nil {
+		t.Fatal("npsso of another account left in the store")
+	}
+
+	session, err := client.Authenticate(ctx, npssoA)
+	if err != nil {
+		t.Fatalf("Authenticate(A) again: %v", err)
+	}
+	if got := session.CurrentTokens().AccessToken; got != "access-v3.a" {
+		t.Fatalf("access token = %q, want access-v3.a", got)
+	}
+	if got := atomic.LoadInt32(&authorizations); got != 2 {
+		t.Fatalf("authorizations = %d, want 2", got)
+	}
+}
+
+func TestFileTokenStoreKeepsNPSSOOutOfFile(t *testing.T) {
+	ctx := context.Background()
+	var authorizations int32
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("NewFileTokenStore: %v", err)
+	}
+	client := newAuthTestClient(t, &authorizations, mustOption(WithTokenStore(store)))
+	npssoA, npssoB := strings.Repeat("a", 64), strings.Repeat("b", 64)
+
+	if _, err := client.Authenticate(ctx, npssoA); err != nil {
+		t.Fatalf("Authenticate(A): %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading token file: %v", err)
+	}
+	if strings.Contains(string(data), npssoA) {
+		t.Fatal("npsso written to the token file")
+	}
+
+	if _, err := client.Authenticate(ctx, npssoA); err != nil {
+		t.Fatalf("Authenticate(A) again: %v", err)
+	}
+	if got := atomic.LoadInt32(&authorizations); got != 1 {
+		t.Fatalf("authorizations = %d, want 1", got)
+	}
+	session, err := client.Authenticate(ctx, npssoB)
+	if err != nil {
+		t.Fatalf("Authenticate(B): %v", err)
+	}
+	if got := session.CurrentTokens().AccessToken; got != "access-v3.b" {
+		t.Fatalf("access token = %q, want access-v3.b", got)
+	}
+	if got := atomic.LoadInt32(&authorizations); got != 2 {
+		t.Fatalf("authorizations = %d, want 2", got)
+	}
+}
+
+// sessionStore is a TokenStore implementing only Load, Save and Delete.
+type sessionStore struct {
+	mu      sync.Mutex
+	session *StoredSession
+}
+
+func (s *sessionStore) Load(_ context.Context) (*StoredSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session == nil {
+		return nil, ErrTokensNotFound
+	}
+	session := *s.session
+	return &session, nil
+}
+
+func (s *sessionStore) Save(_ context.Context, session *StoredSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *session
+	s.session = &saved
+	return nil
+}
+
+func (s *sessionStore) Delete(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = nil
+	return nil
+}
+
+func TestAuthenticateResumesPlainTokenStore(t *testing.T) {
+	ctx := context.Background()
+	var authorizations int32
+	store := &sessionStore{}
+	client := newAuthTestClient(t, &authorizations, mustOption(WithTokenStore(store)))
+	npssoA, npssoB := strings.Repeat("a", 64), strings.Repeat("b", 64)
+
+	if _, err := client.Authenticate(ctx, npssoA); err != nil {
+		t.Fatalf("Authenticate(A): %v", err)
+	}
+	if store.session == nil || store.session.NPSSOHash == "" || strings.Contains(store.session.NPSSOHash, npssoA) {
+		t.Fatalf("stored session = %+v, want the tokens with a hash of the npsso", store.session)
+	}
+
+	// A refresh keeps the tokens bound to the NPSSO token they were issued for
+	session, err := client.Authenticate(ctx, npssoA)
+	if err != nil {
+		t.Fatalf("Authenticate(A) again: %v", err)
+	}
+	session.Tokens.AccessExpiresTime = time.Now().Add(-time.Minute)
+	if _, err := session.Token(ctx); err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if _, err := client.Authenticate(ctx, npssoA); err != nil {
+		t.Fatalf("Authenticate(A) after the refresh: %v", err)
+	}
+	if got := atomic.LoadInt32(&authorizations); got != 1 {
+		t.Fatalf("authorizations = %d, want 1", got)
+	}
+
+	session, err = client.Authenticate(ctx, npssoB)
+	if err != nil {
+		t.Fatalf("Authenticate(B): %v", err)
+	}
+	if got := session.CurrentTokens().AccessToken; got != "access-v3.b" {
+		t.Fatalf("access token = %q, want access-v3.b", got)
+	}
+	if got := atomic.LoadInt32(&authorizations); got != 2 {
+		t.Fatalf("authorizations = %d, want 2", got)
+	}
+}
+
+func TestMalformedNPSSOErrors(t *testing.T) {
+	ctx := context.Background()
+	var authorizations int32
+	client := newAuthTestClient(t, &authorizations)
+
+	if _, err := client.Authenticate(ctx, ""); !errors.Is(err, ErrNPSSOEmpty) {
+		t.Errorf("Authenticate with an empty npsso = %v, want ErrNPSSOEmpty", err)
+	}
+	if _, err := client.Authenticate(ctx, "short"); !errors.Is(err, ErrNPSSOLength) {
+		t.Errorf("Authenticate with a short npsso = %v, want ErrNPSSOLength", err)
+	}
+	if _, err := client.AuthenticateWithTokens(ctx, testTokens(true), "short"); !errors.Is(err, ErrNPSSOLength) {
+		t.Errorf("AuthenticateWithTokens with a short npsso = %v, want ErrNPSSOLength", err)
+	}
+	if got := atomic.LoadInt32(&authorizations); got != 0 {
+		t.Fatalf("authorizations = %d, want 0", got)
+	}
+}
+
+func TestRefreshTokens(t *testing.T) {
+	npsso := strings.Repeat("a", 64)
+	expiredRefresh := testTokens(false)
+	expiredRefresh.RefreshExpiresTime = time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name           string
+		tokens         *Tokens
+		npsso          string
+		refreshStatus  int
+		refreshBody    string
+		wantErr        error
+		wantAccess     string
+		wantGrants     string
+		authorizations int32
+	}{
+		{
+			name:       "valid refresh token",
+			tokens:     testTokens(false),
+			npsso:      npsso,
+			wantAccess: "access-refresh",
+			wantGrants: "refresh_token",
+		},
+		{
+			name:           "rejected refresh token with npsso",
+			tokens:         testTokens(false),
+			npsso:          npsso,
+			refreshStatus:  http.StatusBadRequest,
+			refreshBody:    `{"error":"invalid_grant"}`,
+			wantAccess:     "access-v3.a",
+			wantGrants:     "refresh_token,authorization_code",
+			authorizations: 1,
+		},
+		{
+			name:          "rejected refresh token without npsso",
+			tokens:        testTokens(false),
+			refreshStatus: http.StatusBadRequest,
+			refreshBody:   `{"error":"invalid_grant"}`,
+			wantErr:       ErrSessionExpired,
+			wantGrants:    "refresh_token",
+		},
+		{
+			name:          "unavailable token endpoint",
+			tokens:        testTokens(false),
+			npsso:         npsso,
+			refreshStatus: http.StatusServiceUnavailable,
+			wantErr:       ErrAuthUnavailable,
+			wantGrants:    "refresh_token",
+		},
+		{
+			name:    "expired refresh token without npsso",
+			tokens:  expiredRefresh,
+			wantErr: ErrSessionExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var grants []string
+			var authorizations int32
+			client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/authorize"):
+					atomic.AddInt32(&authorizations, 1)
+					w.Header().Set("Location", "com.scee.psxandroid.scecompcall://redirect?code=v3.a")
+					w.WriteHeader(http.StatusFound)
+				case strings.HasSuffix(r.URL.Path, "/token"):
+					if err := r.ParseForm(); err != nil {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					grant := r.Form.Get("grant_type")
+					mu.Lock()
+					grants = append(grants, grant)
+					mu.Unlock()
+					if grant == "refresh_token" && tt.refreshStatus != 0 {
+						w.WriteHeader(tt.refreshStatus)
+						_, _ = w.Write([]byte(tt.refreshBody))
+						return
+					}
+					if grant == "refresh_token" {
+						writeTokenResponse(w, "access-"+r.Form.Get("refresh_token"), "")
+						return
+					}
+					writeTokenResponse(w, "access-"+r.Form.Get("code"), "refresh-"+r.Form.Get("code"))
+				}
+			}))
+
+			tokens, err := client.refreshTokens(context.Background(), tt.tokens, tt.npsso)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("refreshTokens error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("refreshTokens: %v", err)
+			} else if tokens.AccessToken != tt.wantAccess {
+				t.Fatalf("access token = %q, want %q", tokens.AccessToken, tt.wantAccess)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if got := strings.Join(grants, ","); got != tt.wantGrants {
+				t.Errorf("grants = %q, want %q", got, tt.wantGrants)
+			}
+			if got := atomic.LoadInt32(&authorizations); got != tt.authorizations {
+				t.Errorf("authorizations = %d, want %d", got, tt.authorizations)
+			}
+		})
+	}
+}
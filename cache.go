@@ -0,0 +1,322 @@
+package playstation
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLRUCacheSize is the number of responses kept by an LRUCache created with a non-positive capacity.
+const DefaultLRUCacheSize = 1024
+
+// CacheEntry represents a cached response body of the PlayStation API.
+//
+// Fields:
+//
+//	Body ([]byte): The response body. It must not be modified.
+//	ETag (string): The ETag header of the response, empty if PSN did not send one.
+//	LastModified (string): The Last-Modified header of the response, empty if PSN did not send one.
+//	Expires (time.Time): The time until which the body is used without asking PSN.
+type CacheEntry struct {
+	Body         []byte
+	ETag         string
+	LastModified string
+	Expires      time.Time
+}
+
+// Cache stores the responses of the GET requests of every ClientAPI created from a Client.
+// Expired entries should be kept until they are evicted, so they can be revalidated with a conditional request.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the entry stored under key, and whether there is one.
+	Get(key string) (*CacheEntry, bool)
+	// Set stores the entry under key, replacing any previously stored one.
+	Set(key string, entry *CacheEntry)
+	// Delete removes the entry stored under key. Deleting a missing entry is not an error.
+	Delete(key string)
+}
+
+// CachePolicy defines how long the responses of each operation of the library are cached.
+// Operations are the names of the ClientAPI methods, for example "GetUserProfile".
+// Validate is never cached, as it checks the session against PSN.
+//
+// Fields:
+//
+//	DefaultTTL (time.Duration): The TTL of the operations not listed in TTLs, zero to not cache them.
+//	TTLs (map[string]time.Duration): The TTL of each operation, zero to not cache it.
+type CachePolicy struct {
+	DefaultTTL time.Duration
+	TTLs       map[string]time.Duration
+}
+
+// DefaultCachePolicy returns the default cache policy, which caches profiles for hours and game lists for minutes.
+//
+// Returns:
+//
+//	CachePolicy: The default cache policy.
+func DefaultCachePolicy() CachePolicy {
+	return CachePolicy{
+		TTLs: map[string]time.Duration{
+			"GetUserAccountId": 6 * time.Hour,
+			"GetUserProfile":   6 * time.Hour,
+			"GetUserGames":     10 * time.Minute,
+		},
+	}
+}
+
+// ttl returns how long the responses of the operation are cached.
+func (p CachePolicy) ttl(operation string) time.Duration {
+	if ttl, ok := p.TTLs[operation]; ok {
+		return ttl
+	}
+	return p.DefaultTTL
+}
+
+// WithCache sets a cache for the responses of the GET requests sent by every ClientAPI created from the Client.
+// Responses are reused until their TTL expires, then revalidated with If-None-Match or If-Modified-Since
+// when PSN sent an ETag or Last-Modified header. Responses are cached per language and authenticated account,
+// so the responses of sessions whose access token carries no account ID are not cached.
+// It returns an Options function that sets the cache and cachePolicy fields of the Client struct.
+// If the provided cache is nil or a TTL is negative, it returns an error.
+//
+// Parameters:
+//
+//	cache (Cache): The cache to be used, for example NewLRUCache.
+//	policy (CachePolicy): The TTL of each operation, see DefaultCachePolicy.
+//
+// Returns:
+//
+//	(Options, error): A function that sets the cache of the Client struct, or an error if the cache or the policy is invalid.
+func WithCache(cache Cache, policy CachePolicy) (Options, error) {
+	if cache == nil {
+		return nil, fmt.Errorf("cannot use nil cache")
+	}
+	if policy.DefaultTTL < 0 {
+		return nil, fmt.Errorf("invalid default cache ttl: %s", policy.DefaultTTL)
+	}
+	ttls := make(map[string]time.Duration, len(policy.TTLs))
+	for operation, ttl := range policy.TTLs {
+		if ttl < 0 {
+			return nil, fmt.Errorf("invalid cache ttl for %s: %s", operation, ttl)
+		}
+		ttls[operation] = ttl
+	}
+	policy.TTLs = ttls
+	return func(c *Client) {
+		c.cache = cache
+		c.cachePolicy = policy
+	}, nil
+}
+
+// LRUCache is an in-memory Cache holding a fixed number of entries, evicting the least recently used one when full.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+// lruItem is an entry of an LRUCache along with its key.
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewLRUCache creates a new empty LRUCache.
+//
+// Parameters:
+//
+//	capacity (int): The maximum number of entries, DefaultLRUCacheSize if not positive.
+//
+// Returns:
+//
+//	*LRUCache: A pointer to the newly created LRUCache.
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity <= 0 {
+		capacity = DefaultLRUCacheSize
+	}
+	return &LRUCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the entry stored under key and marks it as recently used.
+func (l *LRUCache) Get(key string) (*CacheEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	element, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(element)
+	return element.Value.(*lruItem).entry, true
+}
+
+// Set stores the entry under key, evicting the least recently used entry if the cache is full.
+func (l *LRUCache) Set(key string, entry *CacheEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, ok := l.items[key]; ok {
+		element.Value.(*lruItem).entry = entry
+		l.order.MoveToFront(element)
+		return
+	}
+	l.items[key] = l.order.PushFront(&lruItem{key: key, entry: entry})
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruItem).key)
+	}
+}
+
+// Delete removes the entry stored under key.
+func (l *LRUCache) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, ok := l.items[key]; ok {
+		l.order.Remove(element)
+		delete(l.items, key)
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (l *LRUCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+// cacheTTL returns how long the response of the request is cached, zero if it is not.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context carrying the operation of the request.
+//	req (apiRequest): The request to be sent.
+//
+// Returns:
+//
+//	time.Duration: The TTL of the response.
+func (c *ClientAPI) cacheTTL(ctx context.Context, req apiRequest) time.Duration {
+	if c.Client.cache == nil || req.noCache || req.method != http.MethodGet {
+		return 0
+	}
+	return c.Client.cachePolicy.ttl(Operation(ctx))
+}
+
+// cacheKey returns the key under which the response of a GET request is cached.
+// Responses depend on the language and on the authenticated account, for example for isMe fields,
+// so both are part of the key. Responses of sessions whose access token carries no account ID are not cached.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the refresh of the tokens, if needed.
+//	endpoint (string): The URL of the request.
+//
+// Returns:
+//
+//	string: The cache key.
+//	bool: false if the response must not be cached because the account is unknown.
+//	error: An error if the session has no valid tokens, for example because it is closed.
+func (c *ClientAPI) cacheKey(ctx context.Context, endpoint string) (string, bool, error) {
+	tokens, err := c.validTokens(ctx, 0)
+	if err != nil {
+		return "", false, err
+	}
+	claims, err := tokens.Claims()
+	if err != nil || claims.AccountID == "" {
+		return "", false, nil
+	}
+	return strings.Join([]string{string(c.Client.lang), claims.AccountID, endpoint}, " "), true, nil
+}
+
+// sendCached sends a GET request through the cache of the Client.
+// A fresh entry is returned without any request, a stale one is revalidated if PSN sent validators for it.
+// The request is sent without the cache if the account of the session is unknown.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the request lifetime.
+//	req (apiRequest): The request to be sent.
+//	endpoint (string): The URL of the request, with its query parameters.
+//	ttl (time.Duration): How long the response is cached.
+//
+// Returns:
+//
+//	[]byte: The response body, possibly from the cache.
+//	error: An error indicating whether the request was successful or not, an *APIError if PSN answered with an error.
+func (c *ClientAPI) sendCached(ctx context.Context, req apiRequest, endpoint string, ttl time.Duration) ([]byte, error) {
+	key, ok, err := c.cacheKey(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		resp, err := c.sendWithRetry(ctx, req, endpoint, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return resp.body, nil
+	}
+
+	cached, ok := c.Client.cache.Get(key)
+	if ok && time.Now().Before(cached.Expires) {
+		return cached.Body, nil
+	}
+
+	var header http.Header
+	if ok && (cached.ETag != "" || cached.LastModified != "") {
+		header = make(http.Header)
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := c.sendWithRetry(ctx, req, endpoint, nil, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.status == http.StatusNotModified {
+		entry := *cached
+		entry.Expires = time.Now().Add(ttl)
+		c.Client.cache.Set(key, &entry)
+		return entry.Body, nil
+	}
+
+	if cacheable(resp) {
+		c.Client.cache.Set(key, &CacheEntry{
+			Body:         resp.body,
+			ETag:         resp.header.Get("ETag"),
+			LastModified: resp.header.Get("Last-Modified"),
+			Expires:      time.Now().Add(ttl),
+		})
+	} else if ok {
+		c.Client.cache.Delete(key)
+	}
+	return resp.body, nil
+}
+
+// cacheable reports whether the response can be cached.
+// Only 200 responses are cached, unless PSN forbids it or the body carries an error object.
+func cacheable(resp *apiResponse) bool {
+	if resp.status != http.StatusOK {
+		return false
+	}
+	if strings.Contains(strings.ToLower(resp.header.Get("Cache-Control")), "no-store") {
+		return false
+	}
+	var requestError RequestError
+	if err := json.Unmarshal(resp.body, &requestError); err != nil {
+		return false
+	}
+	return requestError.Error.Code == 0
+}
@@ -0,0 +1,182 @@
+package playstation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCacheTestClient creates a Client caching every operation for the TTL in the cache,
+// whose endpoints point at a test server running the handler.
+func newCacheTestClient(t *testing.T, cache Cache, ttl time.Duration, handler http.HandlerFunc) *Client {
+	t.Helper()
+	return newTestClient(t, handler, mustOption(WithCache(cache, CachePolicy{DefaultTTL: ttl})))
+}
+
+// profileHandler answers profile requests with an online ID made of the path, language and Authorization header
+// of the request, so responses for different accounts or languages differ, and counts the requests.
+func profileHandler(requests *int32, header http.Header) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		fmt.Fprintf(w, `{"onlineId":%q}`, r.URL.Path+" "+r.Header.Get("Accept-Language")+" "+r.Header.Get("Authorization"))
+	}
+}
+
+// getProfile calls GetUserProfile and returns the online ID of the response, failing the test on error.
+func getProfile(t *testing.T, session *ClientAPI) string {
+	t.Helper()
+	profile, err := session.GetUserProfile(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("GetUserProfile: %v", err)
+	}
+	return profile.OnlineID
+}
+
+func TestCacheReusesFreshResponse(t *testing.T) {
+	var requests int32
+	client := newCacheTestClient(t, NewLRUCache(0), time.Hour, profileHandler(&requests, nil))
+	session := newTestSession(t, client, testAccountTokens("1"))
+
+	first := getProfile(t, session)
+	if second := getProfile(t, session); second != first {
+		t.Fatalf("cached profile = %q, want %q", second, first)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+}
+
+func TestCacheRevalidatesStaleResponse(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	var requests, revalidations int32
+	client := newCacheTestClient(t, NewLRUCache(0), time.Nanosecond, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			atomic.AddInt32(&revalidations, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		fmt.Fprint(w, `{"onlineId":"player"}`)
+	})
+	session := newTestSession(t, client, testAccountTokens("1"))
+
+	for i := 0; i < 3; i++ {
+		if got := getProfile(t, session); got != "player" {
+			t.Fatalf("profile = %q, want player", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Fatalf("requests = %d, want 3", got)
+	}
+	if got := atomic.LoadInt32(&revalidations); got != 2 {
+		t.Fatalf("revalidations = %d, want 2", got)
+	}
+}
+
+func TestCacheSkipsNoStoreResponse(t *testing.T) {
+	var requests int32
+	cache := NewLRUCache(0)
+	client := newCacheTestClient(t, cache, time.Hour, profileHandler(&requests, http.Header{"Cache-Control": {"private, no-store"}}))
+	session := newTestSession(t, client, testAccountTokens("1"))
+
+	getProfile(t, session)
+	getProfile(t, session)
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Fatalf("requests = %d, want 2", got)
+	}
+	if got := cache.Len(); got != 0 {
+		t.Fatalf("cached entries = %d, want 0", got)
+	}
+}
+
+func TestCacheSkipsErrors(t *testing.T) {
+	handlers := map[string]func(w http.ResponseWriter){
+		"error status": func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusNotFound)
+		},
+		"error body": func(w http.ResponseWriter) {
+			fmt.Fprint(w, `{"error":{"code":2240525,"message":"Not permitted by access control"}}`)
+		},
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			var requests int32
+			cache := NewLRUCache(0)
+			client := newCacheTestClient(t, cache, time.Hour, func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				handler(w)
+			})
+			session := newTestSession(t, client, testAccountTokens("1"))
+
+			for i := 0; i < 2; i++ {
+				if _, err := session.GetUserProfile(context.Background(), "42"); err == nil {
+					t.Fatal("GetUserProfile succeeded, want an error")
+				}
+			}
+			if got := atomic.LoadInt32(&requests); got != 2 {
+				t.Fatalf("requests = %d, want 2", got)
+			}
+			if got := cache.Len(); got != 0 {
+				t.Fatalf("cached entries = %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestCacheSeparatesAccountsAndLanguages(t *testing.T) {
+	var requests int32
+	cache := NewLRUCache(0)
+	client := newCacheTestClient(t, cache, time.Hour, profileHandler(&requests, nil))
+	otherLanguage := NewClient(
+		mustOption(WithEndpoints(client.Endpoints())),
+		mustOption(WithLanguage(LangFR)),
+		mustOption(WithCache(cache, CachePolicy{DefaultTTL: time.Hour})),
+	)
+	sessions := []*ClientAPI{
+		newTestSession(t, client, testAccountTokens("1")),
+		newTestSession(t, client, testAccountTokens("2")),
+		newTestSession(t, otherLanguage, testAccountTokens("1")),
+	}
+
+	profiles := make(map[string]bool)
+	for _, session := range sessions {
+		profiles[getProfile(t, session)] = true
+	}
+	for _, session := range sessions {
+		if profile := getProfile(t, session); !profiles[profile] {
+			t.Fatalf("cached profile %q was never returned by the server", profile)
+		}
+	}
+	if len(profiles) != len(sessions) {
+		t.Fatalf("distinct profiles = %d, want %d", len(profiles), len(sessions))
+	}
+	if got := atomic.LoadInt32(&requests); got != int32(len(sessions)) {
+		t.Fatalf("requests = %d, want %d", got, len(sessions))
+	}
+}
+
+func TestCacheSkipsSessionWithoutAccountID(t *testing.T) {
+	var requests int32
+	cache := NewLRUCache(0)
+	client := newCacheTestClient(t, cache, time.Hour, profileHandler(&requests, nil))
+	session := newTestSession(t, client, testTokens(true))
+
+	getProfile(t, session)
+	getProfile(t, session)
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Fatalf("requests = %d, want 2", got)
+	}
+	if got := cache.Len(); got != 0 {
+		t.Fatalf("cached entries = %d, want 0", got)
+	}
+}
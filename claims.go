@@ -0,0 +1,126 @@
+package playstation
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrTokenNotJWT is an error indicating that the access token is not a JSON Web Token.
+var ErrTokenNotJWT = errors.New("access token is not a jwt")
+
+// TokenClaims represents the claims carried by a JWT access token.
+// Claims that are not present in the token are left empty.
+//
+// Fields:
+//
+//	AccountID (string): The account ID of the authenticated user.
+//	ClientID (string): The OAuth client ID the token was issued to.
+//	Scopes ([]string): The scopes granted to the token.
+//	IssuedAt (time.Time): The time at which the token was issued.
+//	ExpiresAt (time.Time): The time at which the token expires.
+//	Country (string): The legal country of the account.
+//	Age (int): The age of the account holder.
+//	Raw (map[string]interface{}): All the claims of the token, numbers being decoded as json.Number.
+type TokenClaims struct {
+	AccountID string
+	ClientID  string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Country   string
+	Age       int
+	Raw       map[string]interface{}
+}
+
+// Claims decodes the claims of the access token without verifying its signature or making any request.
+//
+// Returns:
+//
+//	*TokenClaims: A pointer to the TokenClaims decoded from the access token.
+//	error: An error indicating whether the access token could be decoded or not, ErrTokenNotJWT if it is not a JWT.
+func (t *Tokens) Claims() (*TokenClaims, error) {
+	parts := strings.Split(t.AccessToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenNotJWT
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding token payload: %w", err)
+	}
+
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("error parsing token payload: %w", err)
+	}
+
+	return &TokenClaims{
+		AccountID: claimString(raw, "account_id", "accountId", "sub"),
+		ClientID:  claimString(raw, "client_id", "azp"),
+		Scopes:    claimScopes(raw, "scopes", "scope", "scp"),
+		IssuedAt:  claimTime(raw, "iat"),
+		ExpiresAt: claimTime(raw, "exp"),
+		Country:   claimString(raw, "legal_country", "country"),
+		Age:       int(claimInt(raw, "age")),
+		Raw:       raw,
+	}, nil
+}
+
+// claimString returns the first of the provided claims holding a string or a number, as a string.
+func claimString(raw map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := raw[key].(type) {
+		case string:
+			return v
+		case json.Number:
+			return v.String()
+		}
+	}
+	return ""
+}
+
+// claimInt returns the first of the provided claims holding an integer.
+func claimInt(raw map[string]interface{}, keys ...string) int64 {
+	for _, key := range keys {
+		if n, ok := raw[key].(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// claimTime returns the first of the provided claims holding a Unix timestamp, as a time.Time.
+func claimTime(raw map[string]interface{}, keys ...string) time.Time {
+	if seconds := claimInt(raw, keys...); seconds != 0 {
+		return time.Unix(seconds, 0)
+	}
+	return time.Time{}
+}
+
+// claimScopes returns the first of the provided claims holding scopes, either as a space separated string or a list.
+func claimScopes(raw map[string]interface{}, keys ...string) []string {
+	for _, key := range keys {
+		switch v := raw[key].(type) {
+		case string:
+			return strings.Fields(v)
+		case []interface{}:
+			scopes := make([]string, 0, len(v))
+			for _, scope := range v {
+				if s, ok := scope.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+			return scopes
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package playstation
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jwtWithPayload returns an unsigned JWT access token carrying the payload, base64url encoded with or without padding.
+func jwtWithPayload(payload string, padded bool) string {
+	encoding := base64.RawURLEncoding
+	if padded {
+		encoding = base64.URLEncoding
+	}
+	return "e30." + encoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestClaims(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		padded  bool
+		want    TokenClaims
+	}{
+		{
+			name:    "scopes as a string",
+			payload: `{"account_id":"42","client_id":"app","scope":"psn:mobile.v2.core psn:clientapp","legal_country":"FR","age":30}`,
+			want:    TokenClaims{AccountID: "42", ClientID: "app", Scopes: []string{"psn:mobile.v2.core", "psn:clientapp"}, Country: "FR", Age: 30},
+		},
+		{
+			name:    "scopes as a list",
+			payload: `{"accountId":"42","scopes":["psn:mobile.v2.core","psn:clientapp"]}`,
+			want:    TokenClaims{AccountID: "42", Scopes: []string{"psn:mobile.v2.core", "psn:clientapp"}},
+		},
+		{
+			name:    "numeric account id",
+			payload: `{"account_id":1234567890123456789}`,
+			want:    TokenClaims{AccountID: "1234567890123456789"},
+		},
+		{
+			name:    "padded payload",
+			payload: `{"sub":"4"}`,
+			padded:  true,
+			want:    TokenClaims{AccountID: "4"},
+		},
+		{
+			name:    "timestamps",
+			payload: `{"account_id":"42","iat":1700000000,"exp":1700003600}`,
+			want:    TokenClaims{AccountID: "42", IssuedAt: time.Unix(1700000000, 0), ExpiresAt: time.Unix(1700003600, 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.padded && !strings.Contains(jwtWithPayload(tt.payload, true), "=") {
+				t.Fatal("payload of the test case needs no padding")
+			}
+			tokens := Tokens{AccessToken: jwtWithPayload(tt.payload, tt.padded)}
+
+			claims, err := tokens.Claims()
+			if err != nil {
+				t.Fatalf("Claims: %v", err)
+			}
+			claims.Raw = nil
+			if !reflect.DeepEqual(*claims, tt.want) {
+				t.Fatalf("Claims = %+v, want %+v", *claims, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimsErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessToken string
+		notJWT      bool
+	}{
+		{"opaque token", "opaque-access-token", true},
+		{"two parts", "e30.e30", true},
+		{"invalid base64", "e30.!!!.sig", false},
+		{"invalid json", jwtWithPayload("not json", false), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := Tokens{AccessToken: tt.accessToken}
+
+			_, err := tokens.Claims()
+			if err == nil {
+				t.Fatal("Claims succeeded, want an error")
+			}
+			if got := errors.Is(err, ErrTokenNotJWT); got != tt.notJWT {
+				t.Fatalf("Claims = %v, ErrTokenNotJWT %t, want %t", err, got, tt.notJWT)
+			}
+		})
+	}
+}
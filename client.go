@@ -1,8 +1,13 @@
 package playstation
 
 import (
+	"encoding/base64"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 )
 
 // defaultConfig initializes a Client with default configuration.
@@ -16,6 +21,37 @@ func defaultConfig() Client {
 		lang:       Languages[0],
 		region:     Regions[0],
 		httpClient: http.DefaultClient,
+		oauth:      DefaultOAuthConfig(),
+		endpoints:  DefaultEndpoints(),
+	}
+}
+
+// DefaultOAuthConfig returns the OAuth client parameters of the PlayStation App, used by default.
+// It can be used as a base for WithOAuthConfig, for example to request extra scopes.
+//
+// Returns:
+//
+//	(OAuthConfig): The default OAuth client parameters.
+func DefaultOAuthConfig() OAuthConfig {
+	return OAuthConfig{
+		ClientID:     "09515159-7237-4370-9b40-3806e67c0891",
+		ClientSecret: "ucPjka5tntB2KqsP",
+		Scopes:       []string{"psn:mobile.v2.core", "psn:clientapp"},
+		RedirectURI:  "com.scee.psxandroid.scecompcall://redirect",
+	}
+}
+
+// DefaultEndpoints returns the base URLs of the PSN services, used by default.
+//
+// Returns:
+//
+//	(Endpoints): The default base URLs.
+func DefaultEndpoints() Endpoints {
+	return Endpoints{
+		Auth:          "https://ca.account.sony.com/api/authz/v3/oauth",
+		LegacyProfile: "https://us-prof.np.community.playstation.net",
+		MobileAPI:     "https://m.np.playstation.com/api",
+		GraphQL:       "https://web.np.playstation.com/api/graphql",
 	}
 }
 
@@ -39,11 +75,33 @@ func NewClient(opts ...Options) *Client {
 	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		return http.ErrUseLastResponse
 	}
-	return &Client{
-		httpClient: &httpClient,
-		lang:       c.lang,
-		region:     c.region,
+	client := &Client{
+		httpClient:  &httpClient,
+		lang:        c.lang,
+		region:      c.region,
+		store:       c.store,
+		storeMu:     &sync.Mutex{},
+		oauth:       c.oauth,
+		retry:       c.retry,
+		limiter:     c.limiter,
+		endpoints:   c.endpoints,
+		middlewares: c.middlewares,
+		logger:      c.logger,
+		metrics:     c.metrics,
+		cache:       c.cache,
+		cachePolicy: c.cachePolicy,
+	}
+
+	// The logging and metrics middlewares are the innermost ones, so they see the requests as they are sent
+	middlewares := client.middlewares[:len(client.middlewares):len(client.middlewares)]
+	if client.logger != nil {
+		middlewares = append(middlewares, loggingMiddleware(client.logger))
+	}
+	if client.metrics != nil {
+		middlewares = append(middlewares, metricsMiddleware(client.metrics))
 	}
+	client.roundTrip = chain(middlewares, client.httpClient.Do)
+	return client
 }
 
 // WithLanguage sets a custom language for the Client.
@@ -105,3 +163,263 @@ func WithClient(client *http.Client) (Options, error) {
 		c.httpClient = client
 	}, nil
 }
+
+// WithTokenStore sets a TokenStore used to persist the session tokens of the Client.
+// It returns an Options function that sets the store field of the Client struct.
+// Authenticate resumes the stored session when it is still usable, and the tokens are saved again every time they rotate.
+// A TokenStore holds a single session, so every session of the Client shares it: use ForAccount to create
+// the sessions of other accounts with their own store.
+// If the provided store is nil, it returns an error.
+//
+// Parameters:
+//
+//	store (TokenStore): The store used to load and save the tokens.
+//
+// Returns:
+//
+//	(Options, error): A function that sets the store field of the Client struct, or an error if the store is nil.
+func WithTokenStore(store TokenStore) (Options, error) {
+	if store == nil {
+		return nil, fmt.Errorf("cannot use nil token store")
+	}
+	return func(c *Client) {
+		c.store = store
+	}, nil
+}
+
+// WithOAuthConfig sets custom OAuth client parameters for the Client.
+// It returns an Options function that sets the oauth field of the Client struct.
+// If the provided configuration is incomplete, it returns an error.
+//
+// Parameters:
+//
+//	config (OAuthConfig): The OAuth client parameters to be used, see DefaultOAuthConfig.
+//
+// Returns:
+//
+//	(Options, error): A function that sets the oauth field of the Client struct, or an error if the configuration is incomplete.
+func WithOAuthConfig(config OAuthConfig) (Options, error) {
+	if config.ClientID == "" || config.ClientSecret == "" {
+		return nil, fmt.Errorf("oauth client id and secret are required")
+	}
+	if config.RedirectURI == "" {
+		return nil, fmt.Errorf("oauth redirect uri is required")
+	}
+	if len(config.Scopes) == 0 {
+		return nil, fmt.Errorf("at least one oauth scope is required")
+	}
+	config.Scopes = append([]string(nil), config.Scopes...)
+	return func(c *Client) {
+		c.oauth = config
+	}, nil
+}
+
+// WithRetryPolicy sets the policy used to retry API requests failing with a 429 or 5xx status.
+// It returns an Options function that sets the retry field of the Client struct.
+// Requests are not retried by default; DefaultRetryPolicy provides sensible values.
+// If the provided policy has negative values, it returns an error.
+//
+// Parameters:
+//
+//	policy (RetryPolicy): The retry policy to be used.
+//
+// Returns:
+//
+//	(Options, error): A function that sets the retry field of the Client struct, or an error if the policy is invalid.
+func WithRetryPolicy(policy RetryPolicy) (Options, error) {
+	if policy.MaxAttempts < 0 || policy.InitialBackoff < 0 || policy.MaxBackoff < 0 {
+		return nil, fmt.Errorf("retry policy values cannot be negative")
+	}
+	return func(c *Client) {
+		c.retry = policy
+	}, nil
+}
+
+// WithRateLimit throttles the requests of the Client, including authentication requests, with a token bucket per host.
+// It returns an Options function that sets the limiter field of the Client struct.
+// The limiter is shared by every ClientAPI created from the Client, and waiting requests honor their context.
+// If the rate or burst is not positive, it returns an error.
+//
+// Parameters:
+//
+//	requestsPerSecond (float64): The number of requests allowed per second and per host.
+//	burst (int): The maximum number of requests sent at once to a host.
+//
+// Returns:
+//
+//	(Options, error): A function that sets the limiter field of the Client struct, or an error if the rate or burst is invalid.
+func WithRateLimit(requestsPerSecond float64, burst int) (Options, error) {
+	if requestsPerSecond <= 0 {
+		return nil, fmt.Errorf("rate limit must be positive")
+	}
+	if burst <= 0 {
+		return nil, fmt.Errorf("rate limit burst must be positive")
+	}
+	return func(c *Client) {
+		c.limiter = newHostLimiter(requestsPerSecond, burst)
+	}, nil
+}
+
+// WithEndpoints sets custom base URLs for the PSN services, for example an httptest.Server or a caching proxy.
+// It returns an Options function that sets the endpoints field of the Client struct.
+// Empty fields keep their default value, and trailing slashes are removed.
+// If a URL is not absolute, it returns an error.
+//
+// Parameters:
+//
+//	endpoints (Endpoints): The base URLs to be used.
+//
+// Returns:
+//
+//	(Options, error): A function that sets the endpoints field of the Client struct, or an error if a URL is invalid.
+func WithEndpoints(endpoints Endpoints) (Options, error) {
+	defaults := DefaultEndpoints()
+	fields := []struct {
+		value    *string
+		fallback string
+	}{
+		{&endpoints.Auth, defaults.Auth},
+		{&endpoints.LegacyProfile, defaults.LegacyProfile},
+		{&endpoints.MobileAPI, defaults.MobileAPI},
+		{&endpoints.GraphQL, defaults.GraphQL},
+	}
+	for _, field := range fields {
+		if *field.value == "" {
+			*field.value = field.fallback
+			continue
+		}
+		u, err := url.Parse(*field.value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint url %q", *field.value)
+		}
+		*field.value = strings.TrimRight(*field.value, "/")
+	}
+	return func(c *Client) {
+		c.endpoints = endpoints
+	}, nil
+}
+
+// Endpoints returns the base URLs of the PSN services used by the Client.
+// It can be used to build the URLs of endpoints that are not wrapped by this package.
+//
+// Returns:
+//
+//	(Endpoints): The base URLs used by the Client.
+func (c *Client) Endpoints() Endpoints {
+	return c.endpoints
+}
+
+// ForAccount returns a copy of the Client persisting its sessions to the provided TokenStore instead.
+// Everything else is shared with the Client, including the rate limiter, middlewares, metrics and cache,
+// so it is the way to authenticate several accounts, for example those of an AccountPool, from a single configuration.
+//
+// Parameters:
+//
+//	store (TokenStore): The store of the account, nil to not persist its session.
+//
+// Returns:
+//
+//	(*Client): A pointer to the copy of the Client using the provided store.
+func (c *Client) ForAccount(store TokenStore) *Client {
+	client := *c
+	client.store = store
+	client.storeMu = &sync.Mutex{}
+	return &client
+}
+
+// WithMiddleware adds middlewares wrapping every request of the Client, authentication requests included,
+// for example to add tracing headers, record metrics or journal requests.
+// It returns an Options function that appends to the middlewares field of the Client struct.
+// The first middleware is the outermost one, and middlewares of several WithMiddleware options are applied in order.
+// If a middleware is nil, it returns an error.
+//
+// Parameters:
+//
+//	middlewares (...Middleware): The middlewares to be added.
+//
+// Returns:
+//
+//	(Options, error): A function that appends to the middlewares field of the Client struct, or an error if a middleware is nil.
+func WithMiddleware(middlewares ...Middleware) (Options, error) {
+	for _, middleware := range middlewares {
+		if middleware == nil {
+			return nil, fmt.Errorf("cannot use nil middleware")
+		}
+	}
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares[:len(c.middlewares):len(c.middlewares)], middlewares...)
+	}, nil
+}
+
+// WithLogger sets a logger the Client logs every request to, at debug level, with its method, host, path, status,
+// duration and operation name. Secrets such as the Authorization and Cookie headers, the NPSSO token,
+// authorization codes and tokens are never logged. Nothing is logged when no logger is configured.
+// It returns an Options function that sets the logger field of the Client struct.
+// If the provided logger is nil, it returns an error.
+//
+// Parameters:
+//
+//	logger (*slog.Logger): The logger to be used.
+//
+// Returns:
+//
+//	(Options, error): A function that sets the logger field of the Client struct, or an error if the logger is nil.
+func WithLogger(logger *slog.Logger) (Options, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("cannot use nil logger")
+	}
+	return func(c *Client) {
+		c.logger = logger
+	}, nil
+}
+
+// WithMetrics sets a recorder of the request count, latency, status class, retries and authentication requests
+// of the Client, labeled by host and library operation. NewPrometheusMetrics provides a dependency-free implementation.
+// It returns an Options function that sets the metrics field of the Client struct.
+// If the provided recorder is nil, it returns an error.
+//
+// Parameters:
+//
+//	metrics (Metrics): The metrics recorder to be used.
+//
+// Returns:
+//
+//	(Options, error): A function that sets the metrics field of the Client struct, or an error if the recorder is nil.
+func WithMetrics(metrics Metrics) (Options, error) {
+	if metrics == nil {
+		return nil, fmt.Errorf("cannot use nil metrics")
+	}
+	return func(c *Client) {
+		c.metrics = metrics
+	}, nil
+}
+
+// do sends the request with the HTTP client of the Client, waiting for the rate limiter first if one is configured.
+// The request goes through the middlewares of the Client.
+//
+// Parameters:
+//
+//	req (*http.Request): The request to be sent.
+//
+// Returns:
+//
+//	*http.Response: The response to the request.
+//	error: An error indicating whether the request was sent or not.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.limiter != nil {
+		if err := c.limiter.wait(req.Context(), req.URL.Host); err != nil {
+			return nil, err
+		}
+	}
+	return c.roundTrip(req)
+}
+
+// scope returns the scopes of the OAuth configuration as a space separated string.
+func (o OAuthConfig) scope() string {
+	return strings.Join(o.Scopes, " ")
+}
+
+// basicAuth returns the value of the Authorization header authenticating the OAuth client.
+func (o OAuthConfig) basicAuth() string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(o.ClientID+":"+o.ClientSecret))
+}
@@ -0,0 +1,95 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errPanicked is the error received by the callers waiting for a request whose sender panicked.
+var errPanicked = errors.New("request in flight panicked")
+
+// flightCall represents a GET request in flight, whose response is shared by every identical request.
+//
+// Fields:
+//
+//	done (chan struct{}): The channel closed once the request has completed.
+//	body ([]byte): The response body, set before done is closed. It must not be modified.
+//	err (error): The error of the request, set before done is closed.
+type flightCall struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+// flightGroup coalesces identical requests made at the same time, so only one of them is sent.
+// Its zero value is ready to use.
+//
+// Fields:
+//
+//	mu (sync.Mutex): The mutex guarding calls.
+//	calls (map[string]*flightCall): The requests in flight by key.
+//	waitHook (func()): Called when a caller starts waiting for a request sent by another caller, may be nil.
+type flightGroup struct {
+	mu       sync.Mutex
+	calls    map[string]*flightCall
+	waitHook func()
+}
+
+// do calls fn, unless a call with the same key is already in flight, in which case it waits for its result instead.
+// A caller waiting for a call that failed because the context of its sender was done sends the request itself.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the caller, for controlling the wait.
+//	key (string): The key identifying identical requests.
+//	fn (func() ([]byte, error)): The function sending the request.
+//
+// Returns:
+//
+//	[]byte: The response body, shared with the other callers.
+//	error: The error of the request, or the error of ctx if it is done before the request completes.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	for {
+		g.mu.Lock()
+		if call, ok := g.calls[key]; ok {
+			waitHook := g.waitHook
+			g.mu.Unlock()
+			if waitHook != nil {
+				waitHook()
+			}
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if ctx.Err() == nil && isContextError(call.err) {
+				continue
+			}
+			return call.body, call.err
+		}
+
+		call := &flightCall{done: make(chan struct{})}
+		if g.calls == nil {
+			g.calls = make(map[string]*flightCall)
+		}
+		g.calls[key] = call
+		g.mu.Unlock()
+
+		g.run(key, call, fn)
+		return call.body, call.err
+	}
+}
+
+// run calls fn for the call, then releases the callers waiting for it, even if fn panics.
+func (g *flightGroup) run(key string, call *flightCall, fn func() ([]byte, error)) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	// The error is only left as is if fn panics
+	call.err = errPanicked
+	call.body, call.err = fn()
+}
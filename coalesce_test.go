@@ -0,0 +1,151 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIdenticalGetsAreCoalesced(t *testing.T) {
+	const n = 10
+	var requests int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(entered)
+		}
+		<-release
+		fmt.Fprint(w, `{"onlineId":"player"}`)
+	}))
+	session := newTestSession(t, client, testTokens(true))
+	joined := make(chan struct{}, n)
+	session.flights.waitHook = func() {
+		joined <- struct{}{}
+	}
+
+	profiles := make([]*UserProfileResponse, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	call := func(i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			profiles[i], errs[i] = session.GetUserProfile(context.Background(), "42")
+		}()
+	}
+	call(0)
+	<-entered
+	for i := 1; i < n; i++ {
+		call(i)
+	}
+	for i := 1; i < n; i++ {
+		<-joined
+	}
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+	for i := range profiles {
+		if errs[i] != nil || profiles[i].OnlineID != "player" {
+			t.Fatalf("caller %d got %+v, %v", i, profiles[i], errs[i])
+		}
+	}
+}
+
+func TestCoalescedGetSurvivesCancelledLeader(t *testing.T) {
+	var requests int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// The first request only ends after its sender gave up
+			close(entered)
+			<-release
+			return
+		}
+		fmt.Fprint(w, `{"onlineId":"player"}`)
+	}))
+	session := newTestSession(t, client, testTokens(true))
+	joined := make(chan struct{}, 1)
+	session.flights.waitHook = func() {
+		joined <- struct{}{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leader := make(chan error)
+	go func() {
+		_, err := session.GetUserProfile(ctx, "42")
+		leader <- err
+	}()
+	<-entered
+
+	waiter := make(chan error)
+	var profile *UserProfileResponse
+	go func() {
+		var err error
+		profile, err = session.GetUserProfile(context.Background(), "42")
+		waiter <- err
+	}()
+	<-joined
+	cancel()
+
+	err := <-leader
+	close(release)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader got %v, want context.Canceled", err)
+	}
+	if err := <-waiter; err != nil || profile.OnlineID != "player" {
+		t.Fatalf("waiter got %+v, %v", profile, err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Fatalf("requests = %d, want 2", got)
+	}
+}
+
+func TestFlightGroupReleasesWaitersOnPanic(t *testing.T) {
+	var group flightGroup
+	joined := make(chan struct{})
+	group.waitHook = func() {
+		close(joined)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	recovered := make(chan interface{})
+	go func() {
+		defer func() {
+			recovered <- recover()
+		}()
+		_, _ = group.do(context.Background(), "key", func() ([]byte, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	waiter := make(chan error)
+	go func() {
+		_, err := group.do(context.Background(), "key", func() ([]byte, error) {
+			return nil, errors.New("request sent again")
+		})
+		waiter <- err
+	}()
+	<-joined
+	close(release)
+
+	if got := <-recovered; got != "boom" {
+		t.Fatalf("leader recovered %v, want boom", got)
+	}
+	if err := <-waiter; !errors.Is(err, errPanicked) {
+		t.Fatalf("waiter got %v, want errPanicked", err)
+	}
+}
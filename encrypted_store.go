@@ -0,0 +1,401 @@
+package playstation
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// encryptedStoreVersion is the version of the encrypted token file format, also used as additional authenticated data.
+const encryptedStoreVersion = 1
+
+// passphraseKDF names the key derivation function of files protected by a passphrase.
+const passphraseKDF = "pbkdf2-sha256"
+
+// passphraseIterations is the number of PBKDF2-HMAC-SHA256 iterations used to derive a key from a passphrase.
+const passphraseIterations = 600000
+
+// minPassphraseIterations and maxPassphraseIterations bound the number of iterations accepted from a file,
+// so a tampered file can neither weaken the derivation nor make it run for hours.
+const (
+	minPassphraseIterations = 100000
+	maxPassphraseIterations = 10000000
+)
+
+// ErrDecryptTokens is an error indicating that the token file could not be decrypted, because the key or passphrase is wrong,
+// the file is protected by a passphrase instead of a key or the other way around, or the file has been tampered with.
+var ErrDecryptTokens = errors.New("unable to decrypt token file: wrong key or corrupted file")
+
+// EncryptedFileTokenStore is a TokenStore that keeps the tokens and the optional NPSSO token in a file encrypted with AES-GCM.
+// The key is either supplied directly or derived from a passphrase with PBKDF2-HMAC-SHA256 and a random salt.
+// The file is written with 0600 permissions and replaced atomically on every save.
+// It implements NPSSOStore.
+//
+// Fields:
+//
+//	mu (sync.Mutex): The mutex guarding the file and the cached key.
+//	path (string): The path of the encrypted file.
+//	key ([]byte): The AES key, nil when the key is derived from a passphrase.
+//	passphrase ([]byte): The passphrase the key is derived from, nil when the key is supplied.
+//	salt ([]byte): The salt of the cached derived key.
+//	iterations (int): The number of PBKDF2 iterations of the cached derived key.
+//	derived ([]byte): The key derived from the passphrase, salt and iterations.
+type EncryptedFileTokenStore struct {
+	mu         sync.Mutex
+	path       string
+	key        []byte
+	passphrase []byte
+	salt       []byte
+	iterations int
+	derived    []byte
+}
+
+// encryptedSession represents the plaintext stored in the encrypted token file.
+type encryptedSession struct {
+	Tokens    *Tokens `json:"tokens,omitempty"`
+	NPSSO     string  `json:"npsso,omitempty"`
+	NPSSOHash string  `json:"npsso_hash,omitempty"`
+}
+
+// encryptedFile represents the content of the encrypted token file.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NewEncryptedFileTokenStore creates a new EncryptedFileTokenStore encrypting the file at the provided path with the provided key.
+// The file does not need to exist yet.
+//
+// Parameters:
+//
+//	path (string): The path of the encrypted file.
+//	key ([]byte): The AES key, 16, 24 or 32 bytes long.
+//
+// Returns:
+//
+//	*EncryptedFileTokenStore: A pointer to the newly created EncryptedFileTokenStore.
+//	error: An error if the path is empty or the key has an invalid length.
+func NewEncryptedFileTokenStore(path string, key []byte) (*EncryptedFileTokenStore, error) {
+	if path == "" {
+		return nil, errors.New("token store path is required")
+	}
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("invalid key length %d: must be 16, 24 or 32 bytes", len(key))
+	}
+	return &EncryptedFileTokenStore{
+		path: path,
+		key:  append([]byte(nil), key...),
+	}, nil
+}
+
+// NewEncryptedFileTokenStoreWithPassphrase creates a new EncryptedFileTokenStore encrypting the file at the provided path
+// with a key derived from the provided passphrase. The file does not need to exist yet.
+//
+// Parameters:
+//
+//	path (string): The path of the encrypted file.
+//	passphrase (string): The passphrase the key is derived from.
+//
+// Returns:
+//
+//	*EncryptedFileTokenStore: A pointer to the newly created EncryptedFileTokenStore.
+//	error: An error if the path or the passphrase is empty.
+func NewEncryptedFileTokenStoreWithPassphrase(path string, passphrase string) (*EncryptedFileTokenStore, error) {
+	if path == "" {
+		return nil, errors.New("token store path is required")
+	}
+	if passphrase == "" {
+		return nil, errors.New("passphrase is required")
+	}
+	return &EncryptedFileTokenStore{
+		path:       path,
+		passphrase: []byte(passphrase),
+	}, nil
+}
+
+// Load decrypts the session from the file, or returns ErrTokensNotFound if the file does not exist or holds no tokens.
+func (s *EncryptedFileTokenStore) Load(_ context.Context) (*StoredSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if session.Tokens == nil {
+		return nil, ErrTokensNotFound
+	}
+	return &StoredSession{Tokens: *session.Tokens, NPSSOHash: session.NPSSOHash}, nil
+}
+
+// Save encrypts the session to the file, keeping the stored NPSSO token, and replaces the file atomically.
+func (s *EncryptedFileTokenStore) Save(_ context.Context, stored *StoredSession) error {
+	if stored == nil {
+		return errors.New("cannot save nil session")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.read()
+	if err != nil && !errors.Is(err, ErrTokensNotFound) {
+		return err
+	}
+	tokens := stored.Tokens
+	session.Tokens = &tokens
+	session.NPSSOHash = stored.NPSSOHash
+	return s.write(session)
+}
+
+// LoadNPSSO decrypts the NPSSO token from the file, or returns ErrTokensNotFound if none is stored.
+func (s *EncryptedFileTokenStore) LoadNPSSO(_ context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	if session.NPSSO == "" {
+		return "", ErrTokensNotFound
+	}
+	return session.NPSSO, nil
+}
+
+// SaveNPSSO encrypts the NPSSO token to the file, keeping the stored tokens, and replaces the file atomically.
+func (s *EncryptedFileTokenStore) SaveNPSSO(_ context.Context, npsso string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.read()
+	if err != nil && !errors.Is(err, ErrTokensNotFound) {
+		return err
+	}
+	session.NPSSO = npsso
+	return s.write(session)
+}
+
+// Delete removes the encrypted file, with the session and the NPSSO token.
+func (s *EncryptedFileTokenStore) Delete(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing token file: %w", err)
+	}
+	return nil
+}
+
+// read reads and decrypts the file. It must be called with the mutex held.
+//
+// Returns:
+//
+//	*encryptedSession: A pointer to the decrypted session, empty if the file does not exist.
+//	error: ErrTokensNotFound if the file does not exist, ErrDecryptTokens if it cannot be decrypted, or a read error.
+func (s *EncryptedFileTokenStore) read() (*encryptedSession, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &encryptedSession{}, ErrTokensNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file: %w", err)
+	}
+
+	var file encryptedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing token file: %w", err)
+	}
+	if file.Version != encryptedStoreVersion {
+		return nil, fmt.Errorf("unsupported token file version %d", file.Version)
+	}
+
+	key, err := s.fileKey(&file)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != aead.NonceSize() {
+		return nil, ErrDecryptTokens
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, encryptedStoreAAD())
+	if err != nil {
+		return nil, ErrDecryptTokens
+	}
+
+	var session encryptedSession
+	if err := json.Unmarshal(plaintext, &session); err != nil {
+		return nil, fmt.Errorf("error parsing decrypted tokens: %w", err)
+	}
+	return &session, nil
+}
+
+// write encrypts the session with a fresh nonce and replaces the file atomically. It must be called with the mutex held.
+//
+// Parameters:
+//
+//	session (*encryptedSession): The session to be written.
+//
+// Returns:
+//
+//	error: An error indicating whether the file was written or not.
+func (s *EncryptedFileTokenStore) write(session *encryptedSession) error {
+	plaintext, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("error encoding tokens: %w", err)
+	}
+
+	file := encryptedFile{Version: encryptedStoreVersion}
+	if s.passphrase != nil {
+		if s.salt == nil {
+			s.salt = make([]byte, 16)
+			if _, err := io.ReadFull(rand.Reader, s.salt); err != nil {
+				return fmt.Errorf("error generating salt: %w", err)
+			}
+			s.derived = nil
+		}
+		file.KDF = passphraseKDF
+		file.Iterations = passphraseIterations
+		file.Salt = s.salt
+	}
+
+	key, err := s.fileKey(&file)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, file.Nonce); err != nil {
+		return fmt.Errorf("error generating nonce: %w", err)
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, plaintext, encryptedStoreAAD())
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("error encoding token file: %w", err)
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// fileKey returns the key of a file: the supplied key, or the key derived from the passphrase and the salt of the file.
+// The key derivation parameters of the file are checked before deriving, as they are read from the file before it is authenticated.
+// The derived key is cached for the salt and number of iterations it was derived with, as deriving it is deliberately slow.
+// It must be called with the mutex held.
+//
+// Parameters:
+//
+//	file (*encryptedFile): The file, whose KDF, salt and number of iterations are empty for a supplied key.
+//
+// Returns:
+//
+//	[]byte: The key of the file.
+//	error: An error wrapping ErrDecryptTokens if the file does not match the kind of key of the store
+//	or its key derivation parameters are not supported.
+func (s *EncryptedFileTokenStore) fileKey(file *encryptedFile) ([]byte, error) {
+	if s.passphrase == nil {
+		if file.KDF != "" || file.Salt != nil {
+			return nil, fmt.Errorf("%w: token file is protected by a passphrase, not a key", ErrDecryptTokens)
+		}
+		return s.key, nil
+	}
+
+	if file.KDF == "" && file.Salt == nil {
+		return nil, fmt.Errorf("%w: token file is protected by a key, not a passphrase", ErrDecryptTokens)
+	}
+	if file.KDF != passphraseKDF {
+		return nil, fmt.Errorf("%w: unsupported key derivation function %q", ErrDecryptTokens, file.KDF)
+	}
+	if file.Iterations < minPassphraseIterations || file.Iterations > maxPassphraseIterations {
+		return nil, fmt.Errorf("%w: unsupported number of iterations %d", ErrDecryptTokens, file.Iterations)
+	}
+	if len(file.Salt) == 0 {
+		return nil, fmt.Errorf("%w: missing salt", ErrDecryptTokens)
+	}
+	if s.derived == nil || !bytes.Equal(s.salt, file.Salt) || s.iterations != file.Iterations {
+		s.salt = append([]byte(nil), file.Salt...)
+		s.iterations = file.Iterations
+		s.derived = pbkdf2SHA256(s.passphrase, s.salt, file.Iterations, 32)
+	}
+	return s.derived, nil
+}
+
+// encryptedStoreAAD returns the additional authenticated data binding the ciphertext to the file format version.
+func encryptedStoreAAD() []byte {
+	return []byte(fmt.Sprintf("go-playstation-api/tokens/v%d", encryptedStoreVersion))
+}
+
+// newAEAD creates an AES-GCM cipher with the provided key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// pbkdf2SHA256 derives a key from the password and salt with PBKDF2-HMAC-SHA256, as described by RFC 8018.
+//
+// Parameters:
+//
+//	password ([]byte): The password the key is derived from.
+//	salt ([]byte): The salt.
+//	iterations (int): The number of iterations.
+//	keyLen (int): The length of the derived key.
+//
+// Returns:
+//
+//	[]byte: The derived key.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	derived := make([]byte, 0, blocks*hashLen)
+	buf := make([]byte, 4)
+	u := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf, uint32(block))
+		prf.Write(buf)
+		u = prf.Sum(u[:0])
+
+		t := make([]byte, hashLen)
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		derived = append(derived, t...)
+	}
+	return derived[:keyLen]
+}
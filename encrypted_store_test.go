@@ -0,0 +1,231 @@
+package playstation
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Test vectors of RFC 7914, section 11
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+			"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+			"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		got := pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, 64)
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %x, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+// testKey returns a 32 byte AES key filled with the provided byte.
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestEncryptedFileTokenStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	newStores := map[string]func(path string) (*EncryptedFileTokenStore, error){
+		"key": func(path string) (*EncryptedFileTokenStore, error) {
+			return NewEncryptedFileTokenStore(path, testKey(1))
+		},
+		"passphrase": func(path string) (*EncryptedFileTokenStore, error) {
+			return NewEncryptedFileTokenStoreWithPassphrase(path, "correct horse battery staple")
+		},
+	}
+	for name, newStore := range newStores {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".enc")
+			store, err := newStore(path)
+			if err != nil {
+				t.Fatalf("creating store: %v", err)
+			}
+			tokens := &Tokens{
+				AccessToken:        "access",
+				RefreshToken:       "refresh",
+				AccessExpiresTime:  time.Now().Add(time.Hour).Round(0),
+				RefreshExpiresTime: time.Now().Add(2 * time.Hour).Round(0),
+			}
+			if err := store.Save(ctx, &StoredSession{Tokens: *tokens, NPSSOHash: "hash"}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if err := store.SaveNPSSO(ctx, "secret-npsso"); err != nil {
+				t.Fatalf("SaveNPSSO: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading token file: %v", err)
+			}
+			if bytes.Contains(data, []byte("refresh")) || bytes.Contains(data, []byte("secret-npsso")) {
+				t.Fatalf("token file holds plaintext: %s", data)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if perm := info.Mode().Perm(); perm != 0o600 {
+				t.Fatalf("file mode = %o, want 600", perm)
+			}
+
+			// A new store with the same secret reads the file back
+			reopened, err := newStore(path)
+			if err != nil {
+				t.Fatalf("reopening store: %v", err)
+			}
+			loaded, err := reopened.Load(ctx)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if loaded.Tokens.AccessToken != tokens.AccessToken || loaded.Tokens.RefreshToken != tokens.RefreshToken ||
+				!loaded.Tokens.AccessExpiresTime.Equal(tokens.AccessExpiresTime) ||
+				!loaded.Tokens.RefreshExpiresTime.Equal(tokens.RefreshExpiresTime) || loaded.NPSSOHash != "hash" {
+				t.Fatalf("loaded session = %+v, want %+v", loaded, tokens)
+			}
+			if npsso, err := reopened.LoadNPSSO(ctx); err != nil || npsso != "secret-npsso" {
+				t.Fatalf("LoadNPSSO = %q, %v", npsso, err)
+			}
+
+			if err := reopened.Delete(ctx); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := reopened.Load(ctx); !errors.Is(err, ErrTokensNotFound) {
+				t.Fatalf("Load after Delete: %v, want ErrTokensNotFound", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedFileTokenStoreRejectsWrongSecret(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key.enc")
+	passphrasePath := filepath.Join(dir, "passphrase.enc")
+
+	keyStore, err := NewEncryptedFileTokenStore(keyPath, testKey(1))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileTokenStore: %v", err)
+	}
+	if err := keyStore.Save(ctx, &StoredSession{Tokens: *testTokens(true)}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	passphraseStore, err := NewEncryptedFileTokenStoreWithPassphrase(passphrasePath, "passphrase")
+	if err != nil {
+		t.Fatalf("NewEncryptedFileTokenStoreWithPassphrase: %v", err)
+	}
+	if err := passphraseStore.Save(ctx, &StoredSession{Tokens: *testTokens(true)}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	wrongKey, _ := NewEncryptedFileTokenStore(keyPath, testKey(2))
+	wrongPassphrase, _ := NewEncryptedFileTokenStoreWithPassphrase(passphrasePath, "wrong passphrase")
+	passphraseForKeyFile, _ := NewEncryptedFileTokenStoreWithPassphrase(keyPath, "passphrase")
+	keyForPassphraseFile, _ := NewEncryptedFileTokenStore(passphrasePath, testKey(1))
+	tests := map[string]*EncryptedFileTokenStore{
+		"wrong key":                 wrongKey,
+		"wrong passphrase":          wrongPassphrase,
+		"passphrase for a key file": passphraseForKeyFile,
+		"key for a passphrase file": keyForPassphraseFile,
+	}
+	for name, store := range tests {
+		if _, err := store.Load(ctx); !errors.Is(err, ErrDecryptTokens) {
+			t.Errorf("%s: Load = %v, want ErrDecryptTokens", name, err)
+		}
+	}
+}
+
+func TestEncryptedFileTokenStoreRejectsTamperedFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.enc")
+	store, err := NewEncryptedFileTokenStore(path, testKey(1))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileTokenStore: %v", err)
+	}
+	if err := store.Save(ctx, &StoredSession{Tokens: *testTokens(true)}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading token file: %v", err)
+	}
+	var file encryptedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("parsing token file: %v", err)
+	}
+	file.Ciphertext[0] ^= 1
+	data, err = json.Marshal(file)
+	if err != nil {
+		t.Fatalf("encoding token file: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("writing token file: %v", err)
+	}
+
+	if _, err := store.Load(ctx); !errors.Is(err, ErrDecryptTokens) {
+		t.Fatalf("Load = %v, want ErrDecryptTokens", err)
+	}
+}
+
+func TestEncryptedFileTokenStoreRejectsKDFParameters(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.enc")
+	store, err := NewEncryptedFileTokenStoreWithPassphrase(path, "passphrase")
+	if err != nil {
+		t.Fatalf("NewEncryptedFileTokenStoreWithPassphrase: %v", err)
+	}
+	if err := store.Save(ctx, &StoredSession{Tokens: *testTokens(true)}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading token file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(file *encryptedFile)
+	}{
+		{"unknown kdf", func(file *encryptedFile) { file.KDF = "scrypt" }},
+		{"missing kdf", func(file *encryptedFile) { file.KDF = "" }},
+		{"too few iterations", func(file *encryptedFile) { file.Iterations = 1 }},
+		{"too many iterations", func(file *encryptedFile) { file.Iterations = 1 << 40 }},
+		{"missing salt", func(file *encryptedFile) { file.Salt = []byte{} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file encryptedFile
+			if err := json.Unmarshal(data, &file); err != nil {
+				t.Fatalf("parsing token file: %v", err)
+			}
+			tt.tamper(&file)
+			tampered, err := json.Marshal(file)
+			if err != nil {
+				t.Fatalf("encoding token file: %v", err)
+			}
+			if err := os.WriteFile(path, tampered, 0o600); err != nil {
+				t.Fatalf("writing token file: %v", err)
+			}
+
+			if _, err := store.Load(ctx); !errors.Is(err, ErrDecryptTokens) {
+				t.Fatalf("Load = %v, want ErrDecryptTokens", err)
+			}
+		})
+	}
+}
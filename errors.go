@@ -0,0 +1,286 @@
+package playstation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrNPSSOInvalid is an error indicating that Sony rejected the NPSSO token because it is expired or malformed.
+// The user has to sign in again and provide a new NPSSO token.
+var ErrNPSSOInvalid = errors.New("npsso rejected: expired or invalid")
+
+// ErrInvalidGrant is an error indicating that Sony rejected the refresh token or authorization code.
+// The session can only be recovered with a new NPSSO token or authorization code.
+var ErrInvalidGrant = errors.New("grant rejected: expired, revoked or invalid")
+
+// ErrAuthUnavailable is an error indicating that the Sony account server failed or is rate limiting requests.
+// The request can be retried later.
+var ErrAuthUnavailable = errors.New("authentication server unavailable")
+
+// ErrAuthFailed is an error indicating that the authentication failed for another reason,
+// for example because of an invalid OAuth client configuration.
+var ErrAuthFailed = errors.New("authentication failed")
+
+// ErrRateLimited is an error indicating that PSN rejected the request because the rate limit was exceeded.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ErrSessionInvalid is an error indicating that the session can no longer be used to call the API:
+// its tokens were rejected, can no longer be refreshed or the session was closed.
+var ErrSessionInvalid = errors.New("session invalid")
+
+// APIError represents an error returned by the PlayStation API, either as an unsuccessful status code
+// or as an error object in the response body. It can be retrieved with errors.As, and matches ErrRateLimited
+// for 429 responses and ErrSessionInvalid for 401 responses with errors.Is.
+// StatusCode is always the HTTP status of the response, so an error object in a successful response has
+// StatusCode 200: errors.Is and the IsNotFound, IsRateLimited, IsUnauthorized and IsForbidden helpers only look
+// at the HTTP status and never match it, use Code or Reason to tell those errors apart.
+//
+// Fields:
+//
+//	StatusCode (int): The HTTP status code of the response.
+//	URL (string): The URL of the request, with its query parameters.
+//	Reason (string): The reason of the error, if the response held an error object.
+//	Source (string): The source of the error, if the response held an error object.
+//	Code (int): The PSN error code, if the response held an error object.
+//	Message (string): The error message, if the response held an error object.
+//	ReferenceID (string): The reference ID of the error, if the response held an error object.
+//	RetryAfter (time.Duration): The delay requested by the Retry-After header of the response, if any.
+//	Body ([]byte): The raw body of the response.
+type APIError struct {
+	StatusCode  int
+	URL         string
+	Reason      string
+	Source      string
+	Code        int
+	Message     string
+	ReferenceID string
+	RetryAfter  time.Duration
+	Body        []byte
+}
+
+// Error returns a description of the API error.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("psn api error: status %d", e.StatusCode)
+	if e.Code != 0 {
+		msg += fmt.Sprintf(", code %d", e.Code)
+	}
+	switch {
+	case e.Message != "":
+		msg += ": " + e.Message
+	case e.StatusCode == http.StatusNotFound:
+		msg += ": resource not found: " + e.URL
+	case e.StatusCode == http.StatusTooManyRequests:
+		msg += ": " + ErrRateLimited.Error()
+	case e.Code == 0 && len(e.Body) > 0:
+		msg += ", body: " + string(e.Body)
+	}
+	if e.ReferenceID != "" {
+		msg += " (reference " + e.ReferenceID + ")"
+	}
+	return msg
+}
+
+// Is reports whether the API error matches the target, so that errors.Is(err, ErrRateLimited)
+// and errors.Is(err, ErrSessionInvalid) work with API errors.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrSessionInvalid:
+		return e.StatusCode == http.StatusUnauthorized
+	}
+	return false
+}
+
+// newAPIError creates the APIError of a response, reading the error object from the body if there is one.
+//
+// Parameters:
+//
+//	statusCode (int): The HTTP status code of the response.
+//	url (string): The URL of the request.
+//	body ([]byte): The body of the response.
+//
+// Returns:
+//
+//	*APIError: A pointer to the APIError describing the failure.
+func newAPIError(statusCode int, url string, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		URL:        url,
+		Body:       body,
+	}
+	var requestError RequestError
+	if json.Unmarshal(body, &requestError) == nil {
+		apiErr.Reason = requestError.Error.Reason
+		apiErr.Source = requestError.Error.Source
+		apiErr.Code = requestError.Error.Code
+		apiErr.Message = requestError.Error.Message
+		apiErr.ReferenceID = requestError.Error.ReferenceID
+	}
+	return apiErr
+}
+
+// IsNotFound reports whether the error is an APIError for a resource that does not exist.
+// Like the other helpers, it only looks at the HTTP status of the response, here 404.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsRateLimited reports whether the error is an APIError for a request rejected because of the rate limit.
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// IsUnauthorized reports whether the error is an APIError for a request whose access token was rejected.
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether the error is an APIError for a request the account is not allowed to make,
+// for example because of the privacy settings of another user.
+func IsForbidden(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden
+}
+
+// AuthError represents an error returned by the Sony account server while authenticating.
+// It wraps one of ErrNPSSOInvalid, ErrInvalidGrant, ErrAuthUnavailable or ErrAuthFailed, so it can be checked with errors.Is.
+//
+// Fields:
+//
+//	StatusCode (int): The HTTP status code of the response.
+//	Code (string): The OAuth error code, such as "login_required" or "invalid_grant", if any.
+//	Description (string): The OAuth error description, if any.
+//	Err (error): The sentinel error classifying the failure.
+type AuthError struct {
+	StatusCode  int
+	Code        string
+	Description string
+	Err         error
+}
+
+// Error returns a description of the authentication error.
+func (e *AuthError) Error() string {
+	msg := fmt.Sprintf("%v (status %d", e.Err, e.StatusCode)
+	if e.Code != "" {
+		msg += ", " + e.Code
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg + ")"
+}
+
+// Unwrap returns the sentinel error classifying the failure.
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// oauthErrorResponse represents the error body returned by the OAuth token endpoint.
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// newAuthorizeError creates the AuthError of an authorize request that did not redirect with an authorization code.
+// The OAuth error is read from the query or the fragment of the redirect location, if any. Only an OAuth error
+// meaning that the user must sign in again is classified as ErrNPSSOInvalid: any other unexpected answer,
+// such as a 403 from a proxy or a 400 caused by the OAuth configuration, is ErrAuthFailed.
+//
+// Parameters:
+//
+//	statusCode (int): The HTTP status code of the response.
+//	location (*url.URL): The redirect location of the response, may be nil.
+//
+// Returns:
+//
+//	*AuthError: A pointer to the AuthError describing the failure.
+func newAuthorizeError(statusCode int, location *url.URL) *AuthError {
+	authErr := &AuthError{StatusCode: statusCode}
+	if location != nil {
+		params := location.Query()
+		if params.Get("error") == "" {
+			params, _ = url.ParseQuery(location.Fragment)
+		}
+		authErr.Code = params.Get("error")
+		authErr.Description = params.Get("error_description")
+	}
+
+	switch {
+	case statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests:
+		authErr.Err = ErrAuthUnavailable
+	case authErr.Code == "server_error" || authErr.Code == "temporarily_unavailable":
+		authErr.Err = ErrAuthUnavailable
+	case authErr.Code == "login_required" || authErr.Code == "access_denied" ||
+		authErr.Code == "invalid_grant" || authErr.Code == "interaction_required":
+		authErr.Err = ErrNPSSOInvalid
+	default:
+		authErr.Err = ErrAuthFailed
+	}
+	return authErr
+}
+
+// newTokenError creates the AuthError of a failed request to the OAuth token or revocation endpoint.
+//
+// Parameters:
+//
+//	statusCode (int): The HTTP status code of the response.
+//	body ([]byte): The body of the response, holding the OAuth error if any.
+//
+// Returns:
+//
+//	*AuthError: A pointer to the AuthError describing the failure.
+func newTokenError(statusCode int, body []byte) *AuthError {
+	var oauthErr oauthErrorResponse
+	_ = json.Unmarshal(body, &oauthErr)
+
+	authErr := &AuthError{
+		StatusCode:  statusCode,
+		Code:        oauthErr.Error,
+		Description: oauthErr.ErrorDescription,
+	}
+
+	switch {
+	case statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests:
+		authErr.Err = ErrAuthUnavailable
+	case authErr.Code == "server_error" || authErr.Code == "temporarily_unavailable":
+		authErr.Err = ErrAuthUnavailable
+	case authErr.Code == "invalid_grant":
+		authErr.Err = ErrInvalidGrant
+	default:
+		authErr.Err = ErrAuthFailed
+	}
+	return authErr
+}
+
+// isContextError reports whether the error was caused by a cancelled context or an exceeded deadline.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// isSessionError reports whether the error means that the session is dead, as opposed to a transient failure.
+// ErrAuthFailed is not a session error: it classifies every unexpected answer of the Sony account server,
+// such as a 403 from a proxy, which may well succeed later.
+//
+// Parameters:
+//
+//	err (error): The error to be checked.
+//
+// Returns:
+//
+//	bool: true if the session can no longer be used without re-authenticating.
+func isSessionError(err error) bool {
+	return errors.Is(err, ErrSessionInvalid) ||
+		errors.Is(err, ErrSessionClosed) ||
+		errors.Is(err, ErrSessionExpired) ||
+		errors.Is(err, ErrNPSSOInvalid) ||
+		errors.Is(err, ErrInvalidGrant)
+}
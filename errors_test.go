@@ -0,0 +1,76 @@
+package playstation
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNewAuthorizeError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		location string
+		want     error
+	}{
+		{"login required", http.StatusFound, "com.scee.psxandroid.scecompcall://redirect?error=login_required", ErrNPSSOInvalid},
+		{"access denied in fragment", http.StatusFound, "com.scee.psxandroid.scecompcall://redirect#error=access_denied", ErrNPSSOInvalid},
+		{"invalid grant", http.StatusFound, "com.scee.psxandroid.scecompcall://redirect?error=invalid_grant", ErrNPSSOInvalid},
+		{"interaction required", http.StatusFound, "com.scee.psxandroid.scecompcall://redirect?error=interaction_required", ErrNPSSOInvalid},
+		{"server error", http.StatusFound, "com.scee.psxandroid.scecompcall://redirect?error=server_error", ErrAuthUnavailable},
+		{"temporarily unavailable", http.StatusFound, "com.scee.psxandroid.scecompcall://redirect?error=temporarily_unavailable", ErrAuthUnavailable},
+		{"unknown oauth error", http.StatusFound, "com.scee.psxandroid.scecompcall://redirect?error=invalid_scope", ErrAuthFailed},
+		{"redirect without code", http.StatusFound, "com.scee.psxandroid.scecompcall://redirect", ErrAuthFailed},
+		{"forbidden by a proxy", http.StatusForbidden, "", ErrAuthFailed},
+		{"bad request", http.StatusBadRequest, "", ErrAuthFailed},
+		{"rate limited", http.StatusTooManyRequests, "", ErrAuthUnavailable},
+		{"bad gateway", http.StatusBadGateway, "", ErrAuthUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var location *url.URL
+			if tt.location != "" {
+				var err error
+				if location, err = url.Parse(tt.location); err != nil {
+					t.Fatalf("parsing location: %v", err)
+				}
+			}
+			err := newAuthorizeError(tt.status, location)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("newAuthorizeError = %v, want %v", err, tt.want)
+			}
+			if err.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", err.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestNewTokenError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+		code   string
+	}{
+		{"invalid grant", http.StatusBadRequest, `{"error":"invalid_grant","error_description":"expired"}`, ErrInvalidGrant, "invalid_grant"},
+		{"server error", http.StatusBadRequest, `{"error":"server_error"}`, ErrAuthUnavailable, "server_error"},
+		{"invalid client", http.StatusUnauthorized, `{"error":"invalid_client"}`, ErrAuthFailed, "invalid_client"},
+		{"forbidden by a proxy", http.StatusForbidden, `<html>blocked</html>`, ErrAuthFailed, ""},
+		{"rate limited", http.StatusTooManyRequests, "", ErrAuthUnavailable, ""},
+		{"service unavailable", http.StatusServiceUnavailable, `{"error":"invalid_grant"}`, ErrAuthUnavailable, "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTokenError(tt.status, []byte(tt.body))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("newTokenError = %v, want %v", err, tt.want)
+			}
+			if err.StatusCode != tt.status || err.Code != tt.code {
+				t.Fatalf("status and code = %d %q, want %d %q", err.StatusCode, err.Code, tt.status, tt.code)
+			}
+		})
+	}
+}
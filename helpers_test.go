@@ -0,0 +1,86 @@
+package playstation
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient creates a Client whose endpoints all point at a test server running the handler.
+func newTestClient(t *testing.T, handler http.Handler, opts ...Options) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	endpoints, err := WithEndpoints(Endpoints{
+		Auth:          server.URL,
+		LegacyProfile: server.URL,
+		MobileAPI:     server.URL,
+		GraphQL:       server.URL,
+	})
+	if err != nil {
+		t.Fatalf("WithEndpoints: %v", err)
+	}
+	return NewClient(append([]Options{endpoints}, opts...)...)
+}
+
+// mustOption returns the option, panicking if it could not be created.
+func mustOption(opt Options, err error) Options {
+	if err != nil {
+		panic(err)
+	}
+	return opt
+}
+
+// testTokens returns tokens with a refresh token valid for an hour, and an access token valid for an hour
+// or already expired.
+func testTokens(accessValid bool) *Tokens {
+	accessExpires := time.Now().Add(time.Hour)
+	if !accessValid {
+		accessExpires = time.Now().Add(-time.Minute)
+	}
+	return &Tokens{
+		AccessToken:        "access",
+		RefreshToken:       "refresh",
+		AccessExpiresTime:  accessExpires,
+		RefreshExpiresTime: time.Now().Add(time.Hour),
+	}
+}
+
+// newTestSession resumes a session from the tokens, failing the test on error.
+func newTestSession(t *testing.T, client *Client, tokens *Tokens) *ClientAPI {
+	t.Helper()
+	session, err := client.AuthenticateWithTokens(context.Background(), tokens, "")
+	if err != nil {
+		t.Fatalf("AuthenticateWithTokens: %v", err)
+	}
+	return session
+}
+
+// writeTokenResponse answers a token request with new tokens.
+func writeTokenResponse(w http.ResponseWriter, accessToken string, refreshToken string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":             accessToken,
+		"refresh_token":            refreshToken,
+		"expires_in":               3600,
+		"refresh_token_expires_in": 7200,
+	})
+}
+
+// testJWT returns an unsigned JWT access token whose claims carry the account ID.
+func testJWT(accountID string) string {
+	payload, _ := json.Marshal(map[string]string{"account_id": accountID})
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+// testAccountTokens returns valid tokens whose access token is a JWT of the account.
+func testAccountTokens(accountID string) *Tokens {
+	tokens := testTokens(true)
+	tokens.AccessToken = testJWT(accountID)
+	return tokens
+}
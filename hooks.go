@@ -0,0 +1,165 @@
+package playstation
+
+import "time"
+
+// TokenRefreshFunc is called after the tokens of a session have been refreshed, with the old and new tokens.
+type TokenRefreshFunc func(oldTokens, newTokens Tokens)
+
+// AuthFailureFunc is called when refreshing the tokens of a session failed, with the tokens that could not be refreshed.
+type AuthFailureFunc func(oldTokens Tokens, err error)
+
+// ExpiringFunc is called when the tokens of a session are close to expiry.
+type ExpiringFunc func(event ExpiringEvent)
+
+// ExpiringEvent describes a session whose refresh token is close to expiry.
+// Once the refresh token has expired, the session can only be renewed with the NPSSO token,
+// or not at all if it has none.
+//
+// Fields:
+//
+//	Tokens (Tokens): The current tokens of the session.
+//	ExpiresAt (time.Time): The time at which the refresh token expires.
+//	HasNPSSO (bool): Whether the session has an NPSSO token to re-authenticate once the refresh token has expired.
+type ExpiringEvent struct {
+	Tokens    Tokens
+	ExpiresAt time.Time
+	HasNPSSO  bool
+}
+
+// sessionHooks holds the callbacks registered on a ClientAPI.
+//
+// Fields:
+//
+//	onRefresh ([]TokenRefreshFunc): The callbacks called after a refresh.
+//	onFailure ([]AuthFailureFunc): The callbacks called after a failed refresh.
+//	onExpiring ([]*expiringHook): The callbacks called when the refresh token is close to expiry.
+type sessionHooks struct {
+	onRefresh  []TokenRefreshFunc
+	onFailure  []AuthFailureFunc
+	onExpiring []*expiringHook
+}
+
+// expiringHook is an ExpiringFunc registered with the time before expiry at which it is called.
+//
+// Fields:
+//
+//	within (time.Duration): How long before the expiry of the refresh token the callback is called.
+//	fn (ExpiringFunc): The callback.
+//	notified (string): The refresh token the callback was last called for, so it is called once per refresh token.
+type expiringHook struct {
+	within   time.Duration
+	fn       ExpiringFunc
+	notified string
+}
+
+// OnTokenRefresh registers a callback called after the tokens of the session have been refreshed,
+// for example to keep an audit log. Callbacks are called synchronously by the goroutine performing the refresh
+// and must not block.
+//
+// Parameters:
+//
+//	fn (TokenRefreshFunc): The callback, called with the old and new tokens.
+func (c *ClientAPI) OnTokenRefresh(fn TokenRefreshFunc) {
+	if fn == nil {
+		return
+	}
+	c.mu.Lock()
+	c.hooks.onRefresh = append(c.hooks.onRefresh, fn)
+	c.mu.Unlock()
+}
+
+// OnAuthFailure registers a callback called when refreshing the tokens of the session failed.
+// Callbacks are called synchronously by the goroutine performing the refresh and must not block.
+//
+// Parameters:
+//
+//	fn (AuthFailureFunc): The callback, called with the tokens that could not be refreshed and the error.
+func (c *ClientAPI) OnAuthFailure(fn AuthFailureFunc) {
+	if fn == nil {
+		return
+	}
+	c.mu.Lock()
+	c.hooks.onFailure = append(c.hooks.onFailure, fn)
+	c.mu.Unlock()
+}
+
+// OnNPSSOExpiring registers a callback called once the refresh token of the session is within the provided duration
+// of its expiry, for example to ask the user to link their account again before it breaks.
+// Sony does not tell when the NPSSO token itself expires, but it is needed again as soon as the refresh token has expired,
+// so this is the last point at which the session is known to work without it.
+// The callback is called at most once per refresh token, the next time the session is used or refreshed.
+// Callbacks are called synchronously and must not block.
+//
+// Parameters:
+//
+//	within (time.Duration): How long before the expiry of the refresh token the callback is called.
+//	fn (ExpiringFunc): The callback.
+func (c *ClientAPI) OnNPSSOExpiring(within time.Duration, fn ExpiringFunc) {
+	if fn == nil {
+		return
+	}
+	c.mu.Lock()
+	c.hooks.onExpiring = append(c.hooks.onExpiring, &expiringHook{within: within, fn: fn})
+	c.mu.Unlock()
+}
+
+// notifyRefresh calls the refresh or failure callbacks with the result of a refresh.
+// It must be called without the mutex held.
+//
+// Parameters:
+//
+//	oldTokens (Tokens): The tokens before the refresh.
+//	newTokens (*Tokens): The tokens after the refresh, nil if it failed.
+//	err (error): The error of the refresh, nil if it succeeded.
+func (c *ClientAPI) notifyRefresh(oldTokens Tokens, newTokens *Tokens, err error) {
+	c.mu.Lock()
+	onRefresh := c.hooks.onRefresh
+	onFailure := c.hooks.onFailure
+	c.mu.Unlock()
+
+	if err != nil {
+		for _, fn := range onFailure {
+			fn(oldTokens, err)
+		}
+		return
+	}
+	for _, fn := range onRefresh {
+		fn(oldTokens, *newTokens)
+	}
+}
+
+// notifyExpiring calls the expiring callbacks whose threshold has been reached by the refresh token and that have not
+// been called for it yet. It must be called without the mutex held.
+//
+// Parameters:
+//
+//	tokens (Tokens): The current tokens of the session.
+func (c *ClientAPI) notifyExpiring(tokens Tokens) {
+	// Without a known expiry, the refresh token cannot be told to be close to it
+	if tokens.RefreshToken == "" || tokens.RefreshExpiresTime.IsZero() {
+		return
+	}
+
+	c.mu.Lock()
+	if len(c.hooks.onExpiring) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	var due []ExpiringFunc
+	for _, hook := range c.hooks.onExpiring {
+		if hook.notified != tokens.RefreshToken && time.Until(tokens.RefreshExpiresTime) <= hook.within {
+			hook.notified = tokens.RefreshToken
+			due = append(due, hook.fn)
+		}
+	}
+	event := ExpiringEvent{
+		Tokens:    tokens,
+		ExpiresAt: tokens.RefreshExpiresTime,
+		HasNPSSO:  c.NPSSO != "",
+	}
+	c.mu.Unlock()
+
+	for _, fn := range due {
+		fn(event)
+	}
+}
@@ -0,0 +1,85 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRefreshHooks(t *testing.T) {
+	var refreshes int32
+	session := newAutoRefreshTestSession(t, testTokens(false), http.StatusOK, &refreshes)
+	var oldTokens, newTokens Tokens
+	session.OnTokenRefresh(func(previous, next Tokens) {
+		oldTokens, newTokens = previous, next
+	})
+	session.OnAuthFailure(func(Tokens, error) {
+		t.Error("OnAuthFailure called for a successful refresh")
+	})
+
+	if _, err := session.Token(context.Background()); err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if oldTokens.AccessToken != "access" || newTokens.AccessToken != "access-new" {
+		t.Fatalf("OnTokenRefresh called with %q and %q, want access and access-new", oldTokens.AccessToken, newTokens.AccessToken)
+	}
+}
+
+func TestAuthFailureHook(t *testing.T) {
+	var refreshes int32
+	session := newAutoRefreshTestSession(t, testTokens(false), http.StatusBadRequest, &refreshes)
+	var oldTokens Tokens
+	var failure error
+	session.OnAuthFailure(func(previous Tokens, err error) {
+		oldTokens, failure = previous, err
+	})
+	session.OnTokenRefresh(func(Tokens, Tokens) {
+		t.Error("OnTokenRefresh called for a failed refresh")
+	})
+
+	if _, err := session.Token(context.Background()); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("Token = %v, want ErrSessionExpired", err)
+	}
+	if oldTokens.RefreshToken != "refresh" || !errors.Is(failure, ErrSessionExpired) {
+		t.Fatalf("OnAuthFailure called with %q and %v, want refresh and ErrSessionExpired", oldTokens.RefreshToken, failure)
+	}
+}
+
+func TestNPSSOExpiringHook(t *testing.T) {
+	tests := []struct {
+		name          string
+		refreshExpiry time.Time
+		calls         int
+	}{
+		{"within threshold", time.Now().Add(10 * time.Minute), 1},
+		{"beyond threshold", time.Now().Add(2 * time.Hour), 0},
+		{"unknown expiry", time.Time{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var refreshes int32
+			tokens := testTokens(true)
+			tokens.RefreshExpiresTime = tt.refreshExpiry
+			session := newAutoRefreshTestSession(t, tokens, http.StatusOK, &refreshes)
+			var events []ExpiringEvent
+			session.OnNPSSOExpiring(time.Hour, func(event ExpiringEvent) {
+				events = append(events, event)
+			})
+
+			// The callback is called once per refresh token, however often the session is used
+			for i := 0; i < 2; i++ {
+				if _, err := session.Token(context.Background()); err != nil {
+					t.Fatalf("Token: %v", err)
+				}
+			}
+			if len(events) != tt.calls {
+				t.Fatalf("OnNPSSOExpiring called %d times, want %d", len(events), tt.calls)
+			}
+			if tt.calls > 0 && (!events[0].ExpiresAt.Equal(tt.refreshExpiry) || events[0].HasNPSSO) {
+				t.Fatalf("event = %+v, want expiry %v without npsso", events[0], tt.refreshExpiry)
+			}
+		})
+	}
+}
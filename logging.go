@@ -0,0 +1,112 @@
+package playstation
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redacted replaces secret values in logs.
+const redacted = "REDACTED"
+
+// sensitiveParams lists the query parameters whose values are never logged.
+var sensitiveParams = []string{
+	"npsso",
+	"code",
+	"token",
+	"access_token",
+	"refresh_token",
+	"id_token",
+	"client_secret",
+}
+
+// loggingMiddleware returns a Middleware logging every request at debug level with its method, host, path, redacted query,
+// status, duration and operation name. Headers, and with them the Authorization and Cookie values, are never logged.
+//
+// Parameters:
+//
+//	logger (*slog.Logger): The logger the requests are written to.
+//
+// Returns:
+//
+//	Middleware: The logging middleware.
+func loggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+
+			attrs := []slog.Attr{
+				slog.String("operation", Operation(req.Context())),
+				slog.String("method", req.Method),
+				slog.String("host", req.URL.Host),
+				slog.String("path", req.URL.Path),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if req.URL.RawQuery != "" {
+				attrs = append(attrs, slog.String("query", redactQuery(req.URL.Query())))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", redactError(err, req.URL)))
+				logger.LogAttrs(req.Context(), slog.LevelDebug, "psn request failed", attrs...)
+				return resp, err
+			}
+			attrs = append(attrs, slog.Int("status", resp.StatusCode))
+			logger.LogAttrs(req.Context(), slog.LevelDebug, "psn request", attrs...)
+			return resp, err
+		}
+	}
+}
+
+// redactQuery encodes the query parameters, replacing the values of sensitive parameters.
+//
+// Parameters:
+//
+//	query (url.Values): The query parameters of a request.
+//
+// Returns:
+//
+//	string: The encoded query with sensitive values redacted.
+func redactQuery(query url.Values) string {
+	safe := make(url.Values, len(query))
+	for key, values := range query {
+		if isSensitiveParam(key) {
+			safe[key] = []string{redacted}
+			continue
+		}
+		safe[key] = values
+	}
+	return safe.Encode()
+}
+
+// redactError returns the message of a request error, with the query of the request URL redacted
+// as errors of the HTTP client embed the full URL.
+//
+// Parameters:
+//
+//	err (error): The error of the request.
+//	u (*url.URL): The URL of the request.
+//
+// Returns:
+//
+//	string: The redacted error message.
+func redactError(err error, u *url.URL) string {
+	msg := err.Error()
+	if u.RawQuery == "" {
+		return msg
+	}
+	return strings.ReplaceAll(msg, u.RawQuery, redactQuery(u.Query()))
+}
+
+// isSensitiveParam reports whether the value of the query parameter must never be logged.
+func isSensitiveParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveParams {
+		if key == sensitive {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package playstation
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes by a slog handler.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLoggingRedactsSecrets(t *testing.T) {
+	ctx := context.Background()
+	var output syncBuffer
+	logger := slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/authorize"):
+			w.Header().Set("Location", "com.scee.psxandroid.scecompcall://redirect?code=v3.secretcode")
+			w.WriteHeader(http.StatusFound)
+		case strings.HasSuffix(r.URL.Path, "/token"):
+			if err := r.ParseForm(); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.Form.Get("grant_type") == "refresh_token" {
+				writeTokenResponse(w, "second-access-secret", "second-refresh-secret")
+				return
+			}
+			writeTokenResponse(w, "first-access-secret", "first-refresh-secret")
+		case strings.HasSuffix(r.URL.Path, "/fail"):
+			// Close the connection so the HTTP client returns an error embedding the URL
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		}
+	}), mustOption(WithLogger(logger)))
+	npsso := strings.Repeat("n", 64)
+
+	session, err := client.Authenticate(ctx, npsso)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	session.Tokens.AccessExpiresTime = time.Now().Add(-time.Minute)
+	if _, err := session.Token(ctx); err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	failURL := client.Endpoints().MobileAPI + "/fail?code=v3.secretcode&access_token=second-access-secret&limit=10"
+	if resp, err := session.HTTPClient().Get(failURL); err == nil {
+		resp.Body.Close()
+		t.Fatal("request to a closed connection succeeded")
+	}
+	if err := session.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	logs := output.String()
+	for _, want := range []string{"operation=Authenticate", "operation=RefreshTokens", "psn request failed", "limit=10", "/revoke"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs do not contain %q:\n%s", want, logs)
+		}
+	}
+	for _, secret := range []string{npsso, "secretcode", "first-access-secret", "first-refresh-secret",
+		"second-access-secret", "second-refresh-secret", "Bearer"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("logs contain %q:\n%s", secret, logs)
+		}
+	}
+}
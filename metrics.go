@@ -0,0 +1,265 @@
+package playstation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics is the interface implemented by metric recorders of a Client.
+// Implementations must be safe for concurrent use and should not block.
+type Metrics interface {
+	// ObserveRequest records a request sent to host for the library operation, with its status class
+	// ("2xx", "4xx", "5xx"... or "error" if no response was received) and its latency.
+	ObserveRequest(host, operation, statusClass string, duration time.Duration)
+	// IncRetry records that a request sent to host for the library operation is being retried.
+	IncRetry(host, operation string)
+	// IncAuth records an authentication request with its grant ("npsso", "refresh_token" or "authorization_code")
+	// and its result ("success" or "failure").
+	IncAuth(grant, result string)
+}
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the request latency histogram of PrometheusMetrics.
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a dependency-free Metrics implementation rendering the Prometheus text exposition format.
+// It implements http.Handler, so it can be mounted directly on a metrics endpoint.
+//
+// Fields:
+//
+//	mu (sync.Mutex): The mutex guarding the metrics.
+//	buckets ([]float64): The upper bounds of the latency histogram, in seconds.
+//	requests (map[[3]string]uint64): The request count by host, operation and status class.
+//	latencies (map[[2]string]*histogram): The latency histogram by host and operation.
+//	retries (map[[2]string]uint64): The retry count by host and operation.
+//	auths (map[[2]string]uint64): The authentication count by grant and result.
+type PrometheusMetrics struct {
+	mu        sync.Mutex
+	buckets   []float64
+	requests  map[[3]string]uint64
+	latencies map[[2]string]*histogram
+	retries   map[[2]string]uint64
+	auths     map[[2]string]uint64
+}
+
+// histogram holds the state of a latency histogram.
+//
+// Fields:
+//
+//	counts ([]uint64): The number of observations of each bucket, not cumulative.
+//	sum (float64): The sum of the observations, in seconds.
+//	count (uint64): The number of observations.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusMetrics creates a new PrometheusMetrics.
+//
+// Parameters:
+//
+//	buckets (...float64): The upper bounds of the latency histogram in seconds, DefaultLatencyBuckets if none is provided.
+//
+// Returns:
+//
+//	*PrometheusMetrics: A pointer to the newly created PrometheusMetrics.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		buckets:   buckets,
+		requests:  make(map[[3]string]uint64),
+		latencies: make(map[[2]string]*histogram),
+		retries:   make(map[[2]string]uint64),
+		auths:     make(map[[2]string]uint64),
+	}
+}
+
+// ObserveRequest records a request and its latency.
+func (m *PrometheusMetrics) ObserveRequest(host, operation, statusClass string, duration time.Duration) {
+	seconds := duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[[3]string{host, operation, statusClass}]++
+
+	h, ok := m.latencies[[2]string{host, operation}]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.latencies[[2]string{host, operation}] = h
+	}
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// IncRetry records a retried request.
+func (m *PrometheusMetrics) IncRetry(host, operation string) {
+	m.mu.Lock()
+	m.retries[[2]string{host, operation}]++
+	m.mu.Unlock()
+}
+
+// IncAuth records an authentication request.
+func (m *PrometheusMetrics) IncAuth(grant, result string) {
+	m.mu.Lock()
+	m.auths[[2]string{grant, result}]++
+	m.mu.Unlock()
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+//
+// Parameters:
+//
+//	w (io.Writer): The writer the metrics are written to.
+//
+// Returns:
+//
+//	int64: The number of bytes written.
+//	error: An error indicating whether the metrics were written or not.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	m.mu.Lock()
+	fmt.Fprintln(cw, "# HELP psn_requests_total Number of requests sent to PSN.")
+	fmt.Fprintln(cw, "# TYPE psn_requests_total counter")
+	for _, key := range sortedKeys(m.requests) {
+		fmt.Fprintf(cw, "psn_requests_total{host=%s,operation=%s,status_class=%s} %d\n",
+			quoteLabel(key[0]), quoteLabel(key[1]), quoteLabel(key[2]), m.requests[key])
+	}
+
+	fmt.Fprintln(cw, "# HELP psn_request_duration_seconds Latency of the requests sent to PSN.")
+	fmt.Fprintln(cw, "# TYPE psn_request_duration_seconds histogram")
+	for _, key := range sortedKeys(m.latencies) {
+		h := m.latencies[key]
+		labels := fmt.Sprintf("host=%s,operation=%s", quoteLabel(key[0]), quoteLabel(key[1]))
+		var cumulative uint64
+		for i, bound := range m.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(cw, "psn_request_duration_seconds_bucket{%s,le=%q} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(cw, "psn_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(cw, "psn_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(cw, "psn_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	fmt.Fprintln(cw, "# HELP psn_retries_total Number of requests retried.")
+	fmt.Fprintln(cw, "# TYPE psn_retries_total counter")
+	for _, key := range sortedKeys(m.retries) {
+		fmt.Fprintf(cw, "psn_retries_total{host=%s,operation=%s} %d\n", quoteLabel(key[0]), quoteLabel(key[1]), m.retries[key])
+	}
+
+	fmt.Fprintln(cw, "# HELP psn_auth_total Number of authentication requests, including token refreshes.")
+	fmt.Fprintln(cw, "# TYPE psn_auth_total counter")
+	for _, key := range sortedKeys(m.auths) {
+		fmt.Fprintf(cw, "psn_auth_total{grant=%s,result=%s} %d\n", quoteLabel(key[0]), quoteLabel(key[1]), m.auths[key])
+	}
+	m.mu.Unlock()
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// ServeHTTP renders the metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// countingWriter counts the bytes written and keeps the first write error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// Write writes p unless a previous write failed.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// quoteLabel quotes a label value as required by the Prometheus text exposition format.
+func quoteLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + value + `"`
+}
+
+// sortedKeys returns the keys of the map in lexical order, so the output is stable.
+func sortedKeys[K [2]string | [3]string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
+
+// metricsMiddleware returns a Middleware recording every request with the provided Metrics.
+//
+// Parameters:
+//
+//	metrics (Metrics): The metrics recorder.
+//
+// Returns:
+//
+//	Middleware: The metrics middleware.
+func metricsMiddleware(metrics Metrics) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+
+			statusClass := "error"
+			if err == nil {
+				statusClass = fmt.Sprintf("%dxx", resp.StatusCode/100)
+			}
+			metrics.ObserveRequest(req.URL.Host, Operation(req.Context()), statusClass, time.Since(start))
+			return resp, err
+		}
+	}
+}
+
+// observeAuth records an authentication request with the Metrics of the Client, if configured.
+//
+// Parameters:
+//
+//	grant (string): The grant used to authenticate.
+//	err (error): The error of the authentication request, nil if it succeeded.
+func (c *Client) observeAuth(grant string, err error) {
+	if c.metrics == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	c.metrics.IncAuth(grant, result)
+}
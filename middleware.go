@@ -0,0 +1,66 @@
+package playstation
+
+import (
+	"context"
+	"net/http"
+)
+
+// RoundTripFunc sends an HTTP request and returns its response.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps the sending of every request made by a Client, authentication requests and requests made
+// with ClientAPI.HTTPClient included.
+// It receives the next RoundTripFunc of the chain and returns a RoundTripFunc calling it, so it can inspect or modify
+// the request, the response and the time taken. The library operation a request belongs to is available with
+// Operation(req.Context()).
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// operationKey is the context key holding the name of the library operation.
+type operationKey struct{}
+
+// Operation returns the name of the library operation a request belongs to, such as "GetUserProfile" or "RefreshTokens".
+// It is meant to be called by a Middleware with the context of the request.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the request.
+//
+// Returns:
+//
+//	string: The name of the operation, "HTTPClient" for requests made with ClientAPI.HTTPClient,
+//	or an empty string if the request was not made by the library.
+func Operation(ctx context.Context) string {
+	operation, _ := ctx.Value(operationKey{}).(string)
+	return operation
+}
+
+// withOperation returns a context carrying the name of the library operation.
+//
+// Parameters:
+//
+//	ctx (context.Context): The parent context.
+//	operation (string): The name of the operation.
+//
+// Returns:
+//
+//	context.Context: The context carrying the operation name.
+func withOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+// chain returns the RoundTripFunc sending requests through the middlewares, the first one being the outermost.
+//
+// Parameters:
+//
+//	middlewares ([]Middleware): The middlewares to be applied.
+//	send (RoundTripFunc): The RoundTripFunc actually sending the requests.
+//
+// Returns:
+//
+//	RoundTripFunc: The RoundTripFunc wrapped by the middlewares.
+func chain(middlewares []Middleware, send RoundTripFunc) RoundTripFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		send = middlewares[i](send)
+	}
+	return send
+}
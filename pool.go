@@ -0,0 +1,293 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ErrNoAccountAvailable is an error indicating that an AccountPool has no account, or that every account
+// has been taken out of rotation because of an authentication failure.
+var ErrNoAccountAvailable = errors.New("no account available in pool")
+
+// DefaultPoolCooldown is the time an account is taken out of rotation after hitting the rate limit.
+const DefaultPoolCooldown = time.Minute
+
+// AccountHealth represents the health of an account of an AccountPool.
+//
+// Fields:
+//
+//	Session (*ClientAPI): The session of the account.
+//	Disabled (bool): Whether the account has been taken out of rotation because of an authentication failure.
+//	CooldownUntil (time.Time): The time until which the account is out of rotation because of the rate limit.
+//	Requests (int): The number of calls made with the account.
+//	Failures (int): The number of calls that returned an error.
+//	RateLimited (int): The number of calls that hit the rate limit.
+//	LastError (error): The error of the last failed call, if any.
+//	LastUsed (time.Time): The time of the last call made with the account.
+type AccountHealth struct {
+	Session       *ClientAPI
+	Disabled      bool
+	CooldownUntil time.Time
+	Requests      int
+	Failures      int
+	RateLimited   int
+	LastError     error
+	LastUsed      time.Time
+}
+
+// Available reports whether the account is currently in rotation.
+func (h AccountHealth) Available() bool {
+	return !h.Disabled && !h.CooldownUntil.After(time.Now())
+}
+
+// AccountPool spreads calls across several authenticated sessions, for example one per NPSSO or stored token set.
+// As a TokenStore holds a single session, sessions persisted to the same store cannot be pooled:
+// create them with Client.ForAccount to give each account its own store while sharing the rate limiter.
+// Accounts are used in turn; an account hitting the rate limit is taken out of rotation for a cooldown,
+// extended to the Retry-After delay requested by PSN if longer,
+// and an account whose session is dead is taken out of rotation until it is added again.
+// It is safe for concurrent use.
+//
+// Fields:
+//
+//	mu (sync.Mutex): The mutex guarding the accounts and the rotation.
+//	accounts ([]*AccountHealth): The accounts of the pool and their health.
+//	next (int): The index of the next account to be used.
+//	cooldown (time.Duration): The time an account is out of rotation after hitting the rate limit.
+type AccountPool struct {
+	mu       sync.Mutex
+	accounts []*AccountHealth
+	next     int
+	cooldown time.Duration
+}
+
+// NewAccountPool creates a new AccountPool holding the provided sessions.
+//
+// Parameters:
+//
+//	sessions (...*ClientAPI): The authenticated sessions of the accounts.
+//
+// Returns:
+//
+//	*AccountPool: A pointer to the newly created AccountPool.
+//	error: An error if no session is provided, a session is nil or two sessions share a TokenStore.
+func NewAccountPool(sessions ...*ClientAPI) (*AccountPool, error) {
+	if len(sessions) == 0 {
+		return nil, errors.New("at least one session is required")
+	}
+	p := &AccountPool{cooldown: DefaultPoolCooldown}
+	for _, session := range sessions {
+		if err := p.Add(session); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Add adds a session to the pool. Adding a session that is already in the pool puts it back in rotation,
+// for example after it has been re-authenticated.
+//
+// Parameters:
+//
+//	session (*ClientAPI): The authenticated session to be added.
+//
+// Returns:
+//
+//	error: An error if the session is nil or shares its TokenStore with another session of the pool.
+func (p *AccountPool) Add(session *ClientAPI) error {
+	if session == nil {
+		return errors.New("cannot add nil session to pool")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, account := range p.accounts {
+		if account.Session == session {
+			account.Disabled = false
+			account.CooldownUntil = time.Time{}
+			return nil
+		}
+	}
+	for _, account := range p.accounts {
+		if sameStore(account.Session.Client.store, session.Client.store) {
+			return errors.New("cannot add session sharing its token store with another session of the pool, use Client.ForAccount")
+		}
+	}
+	p.accounts = append(p.accounts, &AccountHealth{Session: session})
+	return nil
+}
+
+// SetCooldown sets the time an account is taken out of rotation after hitting the rate limit.
+//
+// Parameters:
+//
+//	cooldown (time.Duration): The cooldown, DefaultPoolCooldown if not positive.
+func (p *AccountPool) SetCooldown(cooldown time.Duration) {
+	if cooldown <= 0 {
+		cooldown = DefaultPoolCooldown
+	}
+	p.mu.Lock()
+	p.cooldown = cooldown
+	p.mu.Unlock()
+}
+
+// Stats returns a snapshot of the health of every account of the pool.
+//
+// Returns:
+//
+//	[]AccountHealth: The health of the accounts, in the order they were added.
+func (p *AccountPool) Stats() []AccountHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]AccountHealth, len(p.accounts))
+	for i, account := range p.accounts {
+		stats[i] = *account
+	}
+	return stats
+}
+
+// Do calls fn with the session of the next account in rotation.
+// If fn fails because the account hit the rate limit or its session is dead, the account is taken out of rotation
+// and fn is called again with another account, at most once per account, so fn must be safe to repeat.
+// When every remaining account is cooling down, Do waits for the first one to come back or ctx to be done.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the wait for an available account.
+//	fn (func(*ClientAPI) error): The function making the calls with the provided session.
+//
+// Returns:
+//
+//	error: The error returned by fn, ErrNoAccountAvailable if the pool has no account or every account is disabled,
+//	or the error of ctx.
+func (p *AccountPool) Do(ctx context.Context, fn func(session *ClientAPI) error) error {
+	p.mu.Lock()
+	attempts := len(p.accounts)
+	p.mu.Unlock()
+	if attempts == 0 {
+		return ErrNoAccountAvailable
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		account, acquireErr := p.acquire(ctx)
+		if acquireErr != nil {
+			if err != nil {
+				return fmt.Errorf("%w, last error: %w", acquireErr, err)
+			}
+			return acquireErr
+		}
+
+		err = fn(account.Session)
+		if !p.report(account, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// acquire returns the next account in rotation, waiting for a cooling down account if needed.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the wait.
+//
+// Returns:
+//
+//	*AccountHealth: A pointer to the account to be used.
+//	error: ErrNoAccountAvailable if every account is disabled, or the error of ctx.
+func (p *AccountPool) acquire(ctx context.Context) (*AccountHealth, error) {
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		var wakeUp time.Time
+		for i := range p.accounts {
+			account := p.accounts[(p.next+i)%len(p.accounts)]
+			if account.Disabled {
+				continue
+			}
+			if account.CooldownUntil.After(now) {
+				if wakeUp.IsZero() || account.CooldownUntil.Before(wakeUp) {
+					wakeUp = account.CooldownUntil
+				}
+				continue
+			}
+			p.next = (p.next + i + 1) % len(p.accounts)
+			account.Requests++
+			account.LastUsed = now
+			p.mu.Unlock()
+			return account, nil
+		}
+		p.mu.Unlock()
+
+		if wakeUp.IsZero() {
+			return nil, ErrNoAccountAvailable
+		}
+
+		timer := time.NewTimer(time.Until(wakeUp))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// report records the result of a call made with the account and takes it out of rotation if needed.
+//
+// Parameters:
+//
+//	account (*AccountHealth): The account used for the call.
+//	err (error): The error returned by the call, may be nil.
+//
+// Returns:
+//
+//	bool: true if the call failed because of the account and should be retried with another one.
+func (p *AccountPool) report(account *AccountHealth, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	account.Failures++
+	account.LastError = err
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		account.RateLimited++
+		cooldown := p.cooldown
+		if cooldown <= 0 {
+			// The zero value of AccountPool has no cooldown set
+			cooldown = DefaultPoolCooldown
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > cooldown {
+			cooldown = apiErr.RetryAfter
+		}
+		account.CooldownUntil = time.Now().Add(cooldown)
+		return true
+	case isSessionError(err):
+		account.Disabled = true
+		return true
+	default:
+		return false
+	}
+}
+
+// sameStore reports whether both stores are the same TokenStore.
+// Stores of types that cannot be compared are considered different.
+func sameStore(a, b TokenStore) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	typ := reflect.TypeOf(a)
+	if typ != reflect.TypeOf(b) || !typ.Comparable() {
+		return false
+	}
+	return a == b
+}
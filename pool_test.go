@@ -0,0 +1,149 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestPool creates an AccountPool of n sessions, each with its own Client.
+func newTestPool(t *testing.T, n int) (*AccountPool, []*ClientAPI) {
+	t.Helper()
+	sessions := make([]*ClientAPI, n)
+	for i := range sessions {
+		sessions[i] = newTestSession(t, newTestClient(t, http.NotFoundHandler()), testTokens(true))
+	}
+	pool, err := NewAccountPool(sessions...)
+	if err != nil {
+		t.Fatalf("NewAccountPool: %v", err)
+	}
+	return pool, sessions
+}
+
+func TestAccountPoolDisablesOnlyDeadSessions(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		disabled bool
+	}{
+		{"rejected refresh token", fmt.Errorf("%w: %w", ErrSessionExpired, &AuthError{StatusCode: http.StatusBadRequest, Err: ErrInvalidGrant}), true},
+		{"rejected npsso", &AuthError{StatusCode: http.StatusOK, Err: ErrNPSSOInvalid}, true},
+		{"closed session", ErrSessionClosed, true},
+		{"unclassified auth failure", &AuthError{StatusCode: http.StatusForbidden, Err: ErrAuthFailed}, false},
+		{"unavailable auth server", &AuthError{StatusCode: http.StatusBadGateway, Err: ErrAuthUnavailable}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newTestSession(t, newTestClient(t, http.NotFoundHandler()), testTokens(true))
+			pool, err := NewAccountPool(session)
+			if err != nil {
+				t.Fatalf("NewAccountPool: %v", err)
+			}
+
+			_ = pool.Do(context.Background(), func(*ClientAPI) error {
+				return tt.err
+			})
+			if got := pool.Stats()[0].Disabled; got != tt.disabled {
+				t.Fatalf("disabled = %t, want %t", got, tt.disabled)
+			}
+		})
+	}
+}
+
+func TestAccountPoolWithoutAccounts(t *testing.T) {
+	var pool AccountPool
+	err := pool.Do(context.Background(), func(*ClientAPI) error {
+		t.Error("fn called without accounts")
+		return nil
+	})
+	if !errors.Is(err, ErrNoAccountAvailable) {
+		t.Fatalf("Do = %v, want ErrNoAccountAvailable", err)
+	}
+}
+
+func TestAccountPoolRotation(t *testing.T) {
+	pool, sessions := newTestPool(t, 3)
+
+	for i := 0; i < 6; i++ {
+		err := pool.Do(context.Background(), func(session *ClientAPI) error {
+			if session != sessions[i%3] {
+				t.Errorf("call %d used another session than account %d", i, i%3)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+	}
+
+	// A rate limited account is skipped until its cooldown is over
+	var used []*ClientAPI
+	err := pool.Do(context.Background(), func(session *ClientAPI) error {
+		used = append(used, session)
+		if session == sessions[0] {
+			return &APIError{StatusCode: http.StatusTooManyRequests}
+		}
+		return nil
+	})
+	if err != nil || len(used) != 2 || used[1] != sessions[1] {
+		t.Fatalf("Do = %v after using %d sessions, want the call retried with account 1", err, len(used))
+	}
+	for i := 0; i < 4; i++ {
+		_ = pool.Do(context.Background(), func(session *ClientAPI) error {
+			if session == sessions[0] {
+				t.Error("cooling down account used")
+			}
+			return nil
+		})
+	}
+}
+
+func TestAccountPoolCooldownHonoursRetryAfter(t *testing.T) {
+	pool, _ := newTestPool(t, 1)
+	pool.SetCooldown(time.Second)
+
+	_ = pool.Do(context.Background(), func(*ClientAPI) error {
+		return &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+	})
+	account := pool.Stats()[0]
+	if until := time.Until(account.CooldownUntil); until < 59*time.Minute || account.Available() {
+		t.Fatalf("cooldown = %v, want the Retry-After delay of an hour", until)
+	}
+	if account.RateLimited != 1 {
+		t.Fatalf("rate limited = %d, want 1", account.RateLimited)
+	}
+}
+
+func TestAccountPoolWaitsForCoolingDownAccount(t *testing.T) {
+	pool, _ := newTestPool(t, 1)
+	pool.SetCooldown(100 * time.Millisecond)
+	_ = pool.Do(context.Background(), func(*ClientAPI) error {
+		return &APIError{StatusCode: http.StatusTooManyRequests}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := pool.Do(ctx, func(*ClientAPI) error {
+		t.Error("cooling down account used")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Do = %v, want context.DeadlineExceeded", err)
+	}
+
+	start := time.Now()
+	called := false
+	err = pool.Do(context.Background(), func(*ClientAPI) error {
+		called = true
+		return nil
+	})
+	if err != nil || !called {
+		t.Fatalf("Do = %v, called %t, want the account used once its cooldown is over", err, called)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Do returned after %v, want it to wait for the cooldown", elapsed)
+	}
+}
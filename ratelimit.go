@@ -0,0 +1,99 @@
+package playstation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// hostLimiter throttles outgoing requests with one token bucket per host.
+// It is shared by every ClientAPI created from the same Client and is safe for concurrent use.
+//
+// Fields:
+//
+//	mu (sync.Mutex): The mutex guarding the buckets.
+//	rate (float64): The number of requests allowed per second and per host.
+//	burst (int): The maximum number of requests sent at once to a host.
+//	buckets (map[string]*tokenBucket): The token bucket of each host.
+type hostLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket holds the state of the token bucket of a host.
+//
+// Fields:
+//
+//	tokens (float64): The number of available tokens, negative when requests are waiting for tokens.
+//	last (time.Time): The time at which tokens was last updated.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newHostLimiter creates a new hostLimiter.
+//
+// Parameters:
+//
+//	rate (float64): The number of requests allowed per second and per host.
+//	burst (int): The maximum number of requests sent at once to a host.
+//
+// Returns:
+//
+//	*hostLimiter: A pointer to the newly created hostLimiter.
+func newHostLimiter(rate float64, burst int) *hostLimiter {
+	return &hostLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// wait blocks until a request can be sent to the host, or ctx is done.
+// Waiting requests reserve their token, so they are served in order.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the wait.
+//	host (string): The host the request is sent to.
+//
+// Returns:
+//
+//	error: An error if ctx is done, or would be done before a token becomes available.
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	bucket, ok := l.buckets[host]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[host] = bucket
+	}
+	bucket.tokens = min(float64(l.burst), bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+
+	delay := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		l.mu.Unlock()
+		return fmt.Errorf("rate limit wait for %s exceeds context deadline: %w", host, context.DeadlineExceeded)
+	}
+	bucket.tokens--
+	l.mu.Unlock()
+
+	if err := sleepContext(ctx, delay); err != nil {
+		// Give the reserved token back
+		l.mu.Lock()
+		bucket.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
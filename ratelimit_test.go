@@ -0,0 +1,94 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterBurst(t *testing.T) {
+	limiter := newHostLimiter(1, 3)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		if err := limiter.wait(ctx, "host"); err != nil {
+			t.Fatalf("request %d of the burst: %v", i, err)
+		}
+	}
+	if err := limiter.wait(ctx, "host"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request after the burst: %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestHostLimiterWaits(t *testing.T) {
+	limiter := newHostLimiter(20, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.wait(ctx, "host"); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	// The first request uses the burst, the two others wait 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("3 requests at 20 per second took %s, want at least 100ms", elapsed)
+	}
+}
+
+func TestHostLimiterSeparatesHosts(t *testing.T) {
+	limiter := newHostLimiter(0.001, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		if err := limiter.wait(ctx, host); err != nil {
+			t.Fatalf("first request to %s: %v", host, err)
+		}
+	}
+}
+
+func TestHostLimiterFailsEarlyPastDeadline(t *testing.T) {
+	limiter := newHostLimiter(1, 1)
+	if err := limiter.wait(context.Background(), "host"); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.wait(ctx, "host"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("wait failed after %s, want it to fail without waiting", elapsed)
+	}
+	limiter.mu.Lock()
+	tokens := limiter.buckets["host"].tokens
+	limiter.mu.Unlock()
+	if tokens < 0 {
+		t.Fatalf("tokens = %f, the failed request kept its reservation", tokens)
+	}
+}
+
+func TestHostLimiterReturnsTokenOnCancel(t *testing.T) {
+	limiter := newHostLimiter(1, 1)
+	if err := limiter.wait(context.Background(), "host"); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := limiter.wait(ctx, "host"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait = %v, want context.Canceled", err)
+	}
+
+	limiter.mu.Lock()
+	tokens := limiter.buckets["host"].tokens
+	limiter.mu.Unlock()
+	if tokens < 0 {
+		t.Fatalf("tokens = %f, the cancelled request kept its reservation", tokens)
+	}
+}
@@ -0,0 +1,163 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how requests failing with a 429 or 5xx status are retried.
+// Only idempotent requests are retried, and never past the deadline of their context.
+//
+// Fields:
+//
+//	MaxAttempts (int): The maximum number of attempts, including the first one. Values below 2 disable retries.
+//	InitialBackoff (time.Duration): The delay before the first retry.
+//	MaxBackoff (time.Duration): The maximum delay between two attempts, not applied to Retry-After delays.
+//	Multiplier (float64): The factor applied to the delay after every attempt, 2 if not greater than 1.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryPolicy returns a RetryPolicy making up to 3 attempts, starting with a 500ms backoff.
+//
+// Returns:
+//
+//	(RetryPolicy): The default retry policy.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// backoff returns the jittered delay before the provided retry, counting from 1.
+// The delay is picked at random between half and all of the exponential backoff.
+//
+// Parameters:
+//
+//	retry (int): The number of the retry, 1 for the first one.
+//
+// Returns:
+//
+//	time.Duration: The delay before the retry.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	half := delay / 2
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// retryDelay returns how long to wait before retrying a request that failed with the provided error,
+// or false if it must not be retried.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context of the request, whose deadline bounds the delay.
+//	method (string): The HTTP method of the request.
+//	err (error): The error of the failed attempt.
+//	retry (int): The number of the next retry, 1 for the first one.
+//
+// Returns:
+//
+//	time.Duration: The delay before the retry.
+//	bool: true if the request should be retried.
+func (p RetryPolicy) retryDelay(ctx context.Context, method string, err error, retry int) (time.Duration, bool) {
+	if retry >= p.MaxAttempts || !isIdempotent(method) {
+		return 0, false
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests && apiErr.StatusCode < http.StatusInternalServerError {
+		return 0, false
+	}
+
+	delay := apiErr.RetryAfter
+	if delay <= 0 {
+		delay = p.backoff(retry)
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// isIdempotent reports whether requests with the provided HTTP method can safely be sent several times.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number of seconds or an HTTP date.
+//
+// Parameters:
+//
+//	value (string): The value of the header.
+//
+// Returns:
+//
+//	time.Duration: The delay requested by the server, 0 if the header is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// sleepContext waits for the provided delay or until ctx is done.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context interrupting the wait.
+//	delay (time.Duration): The delay to wait for.
+//
+// Returns:
+//
+//	error: The error of ctx if it was done before the end of the delay.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// retryMetrics is a Metrics recording the operations of the retried requests.
+type retryMetrics struct {
+	mu      sync.Mutex
+	retries []string
+}
+
+func (m *retryMetrics) ObserveRequest(host, operation, statusClass string, duration time.Duration) {}
+
+func (m *retryMetrics) IncRetry(host, operation string) {
+	m.mu.Lock()
+	m.retries = append(m.retries, operation)
+	m.mu.Unlock()
+}
+
+func (m *retryMetrics) IncAuth(grant, result string) {}
+
+// newRetryTestSession creates a session retrying with a short backoff, whose requests are all answered with the status
+// and Retry-After header, and counted.
+func newRetryTestSession(t *testing.T, requests *int32, status int, retryAfter string, opts ...Options) *ClientAPI {
+	t.Helper()
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+	}), append([]Options{mustOption(WithRetryPolicy(policy))}, opts...)...)
+	return newTestSession(t, client, testTokens(true))
+}
+
+func TestRetryStopsAtMaxAttempts(t *testing.T) {
+	var requests int32
+	metrics := &retryMetrics{}
+	session := newRetryTestSession(t, &requests, http.StatusServiceUnavailable, "", mustOption(WithMetrics(metrics)))
+
+	_, err := session.GetUserProfile(context.Background(), "42")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("GetUserProfile = %v, want a 503 APIError", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Fatalf("requests = %d, want 3", got)
+	}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if len(metrics.retries) != 2 || metrics.retries[0] != "GetUserProfile" || metrics.retries[1] != "GetUserProfile" {
+		t.Fatalf("retries = %v, want 2 retries of GetUserProfile", metrics.retries)
+	}
+}
+
+func TestRetrySkipsNonIdempotentMethods(t *testing.T) {
+	for _, method := range []string{http.MethodPost, http.MethodPatch} {
+		t.Run(method, func(t *testing.T) {
+			var requests int32
+			session := newRetryTestSession(t, &requests, http.StatusServiceUnavailable, "")
+
+			url := session.Client.endpoints.MobileAPI + "/resource"
+			if _, err := session.send(context.Background(), apiRequest{method: method, url: url, body: struct{}{}}); err == nil {
+				t.Fatal("send succeeded, want an error")
+			}
+			if got := atomic.LoadInt32(&requests); got != 1 {
+				t.Fatalf("requests = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestRetryStopsBeforeDeadline(t *testing.T) {
+	var requests int32
+	session := newRetryTestSession(t, &requests, http.StatusTooManyRequests, "10")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := session.GetUserProfile(ctx, "42")
+	if !IsRateLimited(err) {
+		t.Fatalf("GetUserProfile = %v, want a rate limited APIError", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("the request waited until the deadline")
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+}
+
+func TestRetryWaitsForRetryAfter(t *testing.T) {
+	var requests int32
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"onlineId":"player"}`))
+	}), mustOption(WithRetryPolicy(policy)))
+	session := newTestSession(t, client, testTokens(true))
+
+	start := time.Now()
+	profile, err := session.GetUserProfile(context.Background(), "42")
+	if err != nil || profile.OnlineID != "player" {
+		t.Fatalf("GetUserProfile = %+v, %v", profile, err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %s, want at least the 1s of Retry-After", elapsed)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Fatalf("requests = %d, want 2", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("2"); got != 2*time.Second {
+		t.Errorf("parseRetryAfter(2) = %s, want 2s", got)
+	}
+	date := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got <= 28*time.Second || got > 30*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %s, want about 30s", date, got)
+	}
+	for _, value := range []string{"", "-1", "soon", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)} {
+		if got := parseRetryAfter(value); got != 0 {
+			t.Errorf("parseRetryAfter(%q) = %s, want 0", value, got)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	ctx := context.Background()
+	unavailable := &APIError{StatusCode: http.StatusServiceUnavailable}
+
+	if delay, ok := policy.retryDelay(ctx, http.MethodGet, &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Second}, 1); !ok || delay != 5*time.Second {
+		t.Errorf("delay with Retry-After = %s, %t, want 5s", delay, ok)
+	}
+	if delay, ok := policy.retryDelay(ctx, http.MethodGet, unavailable, 2); !ok || delay < 100*time.Millisecond || delay > 200*time.Millisecond {
+		t.Errorf("backoff of the second retry = %s, %t, want between 100ms and 200ms", delay, ok)
+	}
+	if _, ok := policy.retryDelay(ctx, http.MethodGet, unavailable, 3); ok {
+		t.Error("retried past MaxAttempts")
+	}
+	if _, ok := policy.retryDelay(ctx, http.MethodGet, &APIError{StatusCode: http.StatusNotFound}, 1); ok {
+		t.Error("retried a 404")
+	}
+	for _, method := range []string{http.MethodPost, http.MethodPatch} {
+		if _, ok := policy.retryDelay(ctx, method, unavailable, 1); ok {
+			t.Errorf("retried a %s request", method)
+		}
+	}
+
+	deadline, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, ok := policy.retryDelay(deadline, http.MethodGet, &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}, 1); ok {
+		t.Error("retried past the context deadline")
+	}
+}
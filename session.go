@@ -0,0 +1,296 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// autoRefreshRetryInterval is the delay before the background refresher retries a failed refresh.
+const autoRefreshRetryInterval = 30 * time.Second
+
+// autoRefreshMinInterval is the minimum delay between two refreshes of the background refresher,
+// in case the skew is longer than the lifetime of the access token.
+const autoRefreshMinInterval = 30 * time.Second
+
+// refreshCall represents a token refresh in flight, shared by every caller waiting for new tokens.
+//
+// Fields:
+//
+//	done (chan struct{}): Closed once the refresh has completed.
+//	tokens (*Tokens): The new tokens, set when the refresh succeeded.
+//	err (error): The error of the refresh, set when it failed.
+//	issued (*Tokens): The tokens issued by the refresh, set even if the session was closed meanwhile so Logout can revoke them.
+type refreshCall struct {
+	done   chan struct{}
+	tokens *Tokens
+	err    error
+	issued *Tokens
+}
+
+// CurrentTokens returns a copy of the current tokens of the session.
+// Unlike reading the Tokens field, it is safe to call while other goroutines use the ClientAPI.
+//
+// Returns:
+//
+//	*Tokens: A copy of the current tokens, or nil if the session has none.
+func (c *ClientAPI) CurrentTokens() *Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Tokens == nil {
+		return nil
+	}
+	tokens := *c.Tokens
+	return &tokens
+}
+
+// accessToken returns a valid access token, refreshing the tokens first if the current one has expired.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the refresh, or the wait for a refresh started by another caller.
+//
+// Returns:
+//
+//	string: The access token to be sent with the request.
+//	error: An error indicating whether a valid access token could be obtained or not.
+func (c *ClientAPI) accessToken(ctx context.Context) (string, error) {
+	tokens, err := c.validTokens(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+	return tokens.AccessToken, nil
+}
+
+// validTokens returns tokens whose access token is still valid for at least the provided skew,
+// refreshing them first if needed. Only one refresh is in flight at a time: concurrent callers wait for it
+// and all get either the new tokens or the error of the shared refresh. The refresh runs with the context of the
+// caller performing it, so if that context is done, the waiting callers whose context is not start a new refresh.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the refresh, or the wait for a refresh started by another caller.
+//	skew (time.Duration): The minimum remaining lifetime of the access token before a refresh is needed.
+//
+// Returns:
+//
+//	*Tokens: A copy of the valid tokens.
+//	error: An error indicating whether valid tokens could be obtained or not.
+func (c *ClientAPI) validTokens(ctx context.Context, skew time.Duration) (*Tokens, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if c.Tokens == nil || (c.Tokens.AccessToken == "" && c.Tokens.RefreshToken == "") {
+		c.mu.Unlock()
+		return nil, errors.New("invalid tokens: access or refresh token is required")
+	}
+	if c.Tokens.AccessToken != "" && c.Tokens.AccessExpiresTime.After(time.Now().Add(skew)) {
+		tokens := *c.Tokens
+		c.mu.Unlock()
+		c.notifyExpiring(tokens)
+		return &tokens, nil
+	}
+
+	call := c.refreshing
+	if call == nil {
+		// This caller performs the refresh for everyone
+		call = &refreshCall{done: make(chan struct{})}
+		c.refreshing = call
+		tokens := *c.Tokens
+		npsso := c.NPSSO
+		c.mu.Unlock()
+
+		call.tokens, call.err = c.Client.refreshTokens(ctx, &tokens, npsso)
+
+		c.mu.Lock()
+		call.issued = call.tokens
+		closed := c.closed
+		if closed {
+			// The session was closed while refreshing, the new tokens must not revive it
+			call.tokens, call.err = nil, ErrSessionClosed
+		}
+		if call.err == nil {
+			c.Tokens = call.tokens
+		}
+		if errors.Is(call.err, ErrSessionExpired) && c.Tokens != nil {
+			// The refresh token was rejected, so later calls fail without asking Sony again
+			expired := *c.Tokens
+			expired.RefreshExpiresTime = time.Now()
+			c.Tokens = &expired
+		}
+		c.refreshing = nil
+		c.mu.Unlock()
+		close(call.done)
+
+		if !closed {
+			c.notifyRefresh(tokens, call.tokens, call.err)
+			if call.err == nil {
+				c.notifyExpiring(*call.tokens)
+			}
+		}
+	} else {
+		waitHook := c.refreshWaitHook
+		c.mu.Unlock()
+		if waitHook != nil {
+			waitHook()
+		}
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for token refresh: %w", ctx.Err())
+		}
+		if ctx.Err() == nil && isContextError(call.err) {
+			// The refresh was cancelled by the context of the caller performing it, not by ours
+			return c.validTokens(ctx, skew)
+		}
+	}
+
+	if call.err != nil {
+		return nil, fmt.Errorf("error refreshing tokens: %w", call.err)
+	}
+	tokens := *call.tokens
+	return &tokens, nil
+}
+
+// StartAutoRefresh starts a background goroutine renewing the access token the provided skew before it expires,
+// so that requests never wait for a refresh. The goroutine stops when ctx is cancelled or the session is closed
+// or can no longer be refreshed. Transient refresh failures are retried every autoRefreshRetryInterval.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context controlling the lifetime of the background refresher.
+//	skew (time.Duration): How long before the access token expires it is renewed, must be positive.
+//
+// Returns:
+//
+//	error: An error if the skew is not positive, the session is closed or a refresher is already running.
+func (c *ClientAPI) StartAutoRefresh(ctx context.Context, skew time.Duration) error {
+	if skew <= 0 {
+		return errors.New("auto refresh skew must be positive")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrSessionClosed
+	}
+	if c.stopAutoRefresh != nil {
+		return errors.New("auto refresh already running")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.stopAutoRefresh = cancel
+
+	go c.autoRefresh(ctx, cancel, skew)
+	return nil
+}
+
+// autoRefresh is the loop run by StartAutoRefresh.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context controlling the lifetime of the loop, cancelled by Logout.
+//	cancel (context.CancelFunc): The function cancelling ctx, called once the loop stops.
+//	skew (time.Duration): How long before the access token expires it is renewed.
+func (c *ClientAPI) autoRefresh(ctx context.Context, cancel context.CancelFunc, skew time.Duration) {
+	defer func() {
+		cancel()
+		c.mu.Lock()
+		c.stopAutoRefresh = nil
+		c.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		wait := autoRefreshRetryInterval
+		tokens, err := c.validTokens(ctx, skew)
+		switch {
+		case isSessionError(err):
+			// Retrying cannot help once the session is closed or its credentials are rejected
+			return
+		case err == nil:
+			wait = max(time.Until(tokens.AccessExpiresTime)-skew, autoRefreshMinInterval)
+		}
+		timer.Reset(wait)
+	}
+}
+
+// Logout closes the session: it revokes the access and refresh tokens at the Sony OAuth server,
+// deletes them from the TokenStore of the Client if it still holds the account of the session,
+// and makes every later call fail with ErrSessionClosed. The background refresher started by StartAutoRefresh is stopped.
+// The session is closed even if the revocation fails, in which case the revocation errors are returned.
+// A refresh in flight is waited for, so the tokens it issues are revoked and deleted as well.
+// The NPSSO cookie itself is a web session and is not revoked; it is only forgotten by the ClientAPI.
+// Calling Logout on a closed session does nothing.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the request lifetime.
+//
+// Returns:
+//
+//	error: An error indicating whether the tokens were revoked and deleted or not.
+func (c *ClientAPI) Logout(ctx context.Context) error {
+	ctx = withOperation(ctx, "Logout")
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	revoke := []*Tokens{c.Tokens}
+	call := c.refreshing
+	if c.stopAutoRefresh != nil {
+		c.stopAutoRefresh()
+	}
+	c.closed = true
+	c.Tokens = nil
+	c.NPSSO = ""
+	c.mu.Unlock()
+
+	var errs []error
+	if call != nil {
+		// The refresh saves its tokens to the store, so it must complete before the store is deleted
+		select {
+		case <-call.done:
+			revoke = append(revoke, call.issued)
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("waiting for token refresh: %w", ctx.Err()))
+		}
+	}
+
+	revoked := make(map[string]bool)
+	for _, tokens := range revoke {
+		if tokens == nil {
+			continue
+		}
+		if tokens.refreshValid() && !revoked[tokens.RefreshToken] {
+			revoked[tokens.RefreshToken] = true
+			if err := c.Client.revokeRequest(ctx, tokens.RefreshToken, "refresh_token"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if tokens.accessValid() && !revoked[tokens.AccessToken] {
+			revoked[tokens.AccessToken] = true
+			if err := c.Client.revokeRequest(ctx, tokens.AccessToken, "access_token"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	// The store may hold the session of another account of the Client by now, which must be kept
+	if err := c.Client.deleteSession(ctx, revoke); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,389 @@
+package playstation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// refreshConcurrently calls Token from n goroutines: the first one performs the refresh, which blocks in the /token
+// handler until release is closed, and the others wait for it. It returns the results of every caller.
+func refreshConcurrently(t *testing.T, session *ClientAPI, n int, entered <-chan struct{}, release chan<- struct{}) ([]string, []error) {
+	t.Helper()
+	joined := make(chan struct{}, n)
+	session.refreshWaitHook = func() {
+		joined <- struct{}{}
+	}
+
+	tokens := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	call := func(i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], errs[i] = session.Token(context.Background())
+		}()
+	}
+
+	call(0)
+	<-entered
+	for i := 1; i < n; i++ {
+		call(i)
+	}
+	for i := 1; i < n; i++ {
+		<-joined
+	}
+	close(release)
+	wg.Wait()
+	return tokens, errs
+}
+
+func TestTokenRefreshSingleFlight(t *testing.T) {
+	var calls int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(entered)
+		}
+		<-release
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "refresh_token" {
+			t.Errorf("unexpected token request: %v %v", err, r.Form)
+		}
+		writeTokenResponse(w, "new-access", "new-refresh")
+	}))
+	session := newTestSession(t, client, testTokens(false))
+
+	tokens, errs := refreshConcurrently(t, session, 20, entered, release)
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("token requests = %d, want 1", got)
+	}
+	for i := range tokens {
+		if errs[i] != nil || tokens[i] != "new-access" {
+			t.Fatalf("caller %d got %q, %v", i, tokens[i], errs[i])
+		}
+	}
+	if got := session.CurrentTokens().RefreshToken; got != "new-refresh" {
+		t.Fatalf("refresh token = %q, want new-refresh", got)
+	}
+}
+
+func TestTokenRefreshSharedError(t *testing.T) {
+	var calls int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(entered)
+		}
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	session := newTestSession(t, client, testTokens(false))
+
+	_, errs := refreshConcurrently(t, session, 20, entered, release)
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("token requests = %d, want 1", got)
+	}
+	for i, err := range errs {
+		if !errors.Is(err, ErrAuthUnavailable) {
+			t.Fatalf("caller %d got %v, want ErrAuthUnavailable", i, err)
+		}
+	}
+}
+
+func TestTokenRefreshSurvivesCancelledLeader(t *testing.T) {
+	var calls int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// The first refresh only ends after its caller gave up
+			close(entered)
+			<-release
+			return
+		}
+		writeTokenResponse(w, "new-access", "new-refresh")
+	}))
+	session := newTestSession(t, client, testTokens(false))
+	joined := make(chan struct{}, 1)
+	session.refreshWaitHook = func() {
+		joined <- struct{}{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leader := make(chan error)
+	go func() {
+		_, err := session.Token(ctx)
+		leader <- err
+	}()
+	<-entered
+
+	waiter := make(chan error)
+	var token string
+	go func() {
+		var err error
+		token, err = session.Token(context.Background())
+		waiter <- err
+	}()
+	<-joined
+	cancel()
+
+	err := <-leader
+	close(release)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader got %v, want context.Canceled", err)
+	}
+	if err := <-waiter; err != nil || token != "new-access" {
+		t.Fatalf("waiter got %q, %v, want new-access", token, err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("token requests = %d, want 2", got)
+	}
+}
+
+// newAutoRefreshTestSession resumes a session from the tokens whose /token endpoint counts the refreshes
+// and answers them with the provided status, or with new tokens if the status is 200.
+func newAutoRefreshTestSession(t *testing.T, tokens *Tokens, status int, refreshes *int32) *ClientAPI {
+	t.Helper()
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/token") {
+			return
+		}
+		atomic.AddInt32(refreshes, 1)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		writeTokenResponse(w, "access-new", "refresh-new")
+	}))
+	return newTestSession(t, client, tokens)
+}
+
+// waitAutoRefreshStopped waits for the background refresher of the session to stop, failing the test after a second.
+func waitAutoRefreshStopped(t *testing.T, session *ClientAPI) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		session.mu.Lock()
+		running := session.stopAutoRefresh != nil
+		session.mu.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("auto refresh still running")
+}
+
+func TestAutoRefreshRenewsSkewBeforeExpiry(t *testing.T) {
+	var refreshes int32
+	expiring := testTokens(true)
+	expiring.AccessExpiresTime = time.Now().Add(30 * time.Minute)
+	session := newAutoRefreshTestSession(t, expiring, http.StatusOK, &refreshes)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := session.StartAutoRefresh(ctx, time.Hour); err != nil {
+		t.Fatalf("StartAutoRefresh: %v", err)
+	}
+	if err := session.StartAutoRefresh(ctx, time.Hour); err == nil {
+		t.Fatal("second StartAutoRefresh succeeded, want an error")
+	}
+	deadline := time.Now().Add(time.Second)
+	for session.CurrentTokens().AccessToken != "access-new" {
+		if time.Now().After(deadline) {
+			t.Fatal("access token expiring within the skew not renewed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&refreshes); got != 1 {
+		t.Fatalf("refreshes = %d, want 1", got)
+	}
+	cancel()
+	waitAutoRefreshStopped(t, session)
+
+	// An access token outliving the skew is left alone
+	var laterRefreshes int32
+	session = newAutoRefreshTestSession(t, testTokens(true), http.StatusOK, &laterRefreshes)
+	if err := session.StartAutoRefresh(context.Background(), 30*time.Minute); err != nil {
+		t.Fatalf("StartAutoRefresh: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := session.Logout(context.Background()); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	waitAutoRefreshStopped(t, session)
+	if got := atomic.LoadInt32(&laterRefreshes); got != 0 {
+		t.Fatalf("refreshes = %d, want 0", got)
+	}
+}
+
+func TestAutoRefreshStops(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens *Tokens
+		status int
+		stop   func(t *testing.T, session *ClientAPI, cancel context.CancelFunc)
+	}{
+		{
+			name:   "context cancelled",
+			tokens: testTokens(true),
+			status: http.StatusOK,
+			stop: func(t *testing.T, session *ClientAPI, cancel context.CancelFunc) {
+				cancel()
+			},
+		},
+		{
+			name:   "logout",
+			tokens: testTokens(true),
+			status: http.StatusOK,
+			stop: func(t *testing.T, session *ClientAPI, cancel context.CancelFunc) {
+				if err := session.Logout(context.Background()); err != nil {
+					t.Fatalf("Logout: %v", err)
+				}
+			},
+		},
+		{
+			name:   "rejected refresh token",
+			tokens: testTokens(false),
+			status: http.StatusBadRequest,
+			stop:   func(t *testing.T, session *ClientAPI, cancel context.CancelFunc) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var refreshes int32
+			session := newAutoRefreshTestSession(t, tt.tokens, tt.status, &refreshes)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := session.StartAutoRefresh(ctx, time.Minute); err != nil {
+				t.Fatalf("StartAutoRefresh: %v", err)
+			}
+			tt.stop(t, session, cancel)
+			waitAutoRefreshStopped(t, session)
+		})
+	}
+}
+
+// revokeRecorder records the tokens revoked at the /revoke endpoint as token:hint.
+type revokeRecorder struct {
+	mu      sync.Mutex
+	revoked []string
+}
+
+func (r *revokeRecorder) record(req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		return
+	}
+	r.mu.Lock()
+	r.revoked = append(r.revoked, req.Form.Get("token")+":"+req.Form.Get("token_type_hint"))
+	r.mu.Unlock()
+}
+
+func (r *revokeRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.revoked, ",")
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	ctx := context.Background()
+	var revokes revokeRecorder
+	store := NewMemoryTokenStore()
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/revoke") {
+			revokes.record(r)
+		}
+	}), mustOption(WithTokenStore(store)))
+	session := newTestSession(t, client, testTokens(true))
+
+	if err := session.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if got := revokes.String(); got != "refresh:refresh_token,access:access_token" {
+		t.Fatalf("revoked = %q, want refresh:refresh_token,access:access_token", got)
+	}
+	if _, err := store.Load(ctx); !errors.Is(err, ErrTokensNotFound) {
+		t.Fatalf("store Load = %v, want ErrTokensNotFound", err)
+	}
+
+	if _, err := session.Token(ctx); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("Token after Logout = %v, want ErrSessionClosed", err)
+	}
+	if _, err := session.GetUserProfile(ctx, "42"); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("GetUserProfile after Logout = %v, want ErrSessionClosed", err)
+	}
+	if err := session.StartAutoRefresh(ctx, time.Minute); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("StartAutoRefresh after Logout = %v, want ErrSessionClosed", err)
+	}
+	if err := session.Logout(ctx); err != nil {
+		t.Errorf("second Logout = %v, want nil", err)
+	}
+	if got := revokes.String(); got != "refresh:refresh_token,access:access_token" {
+		t.Fatalf("revoked after a second Logout = %q", got)
+	}
+}
+
+func TestLogoutRevokesTokensOfRefreshInFlight(t *testing.T) {
+	ctx := context.Background()
+	var revokes revokeRecorder
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/token"):
+			close(entered)
+			<-release
+			writeTokenResponse(w, "access-new", "refresh-new")
+		case strings.HasSuffix(r.URL.Path, "/revoke"):
+			revokes.record(r)
+		}
+	}))
+	session := newTestSession(t, client, testTokens(false))
+
+	refreshed := make(chan error, 1)
+	go func() {
+		_, err := session.Token(ctx)
+		refreshed <- err
+	}()
+	<-entered
+
+	loggedOut := make(chan error, 1)
+	go func() {
+		loggedOut <- session.Logout(ctx)
+	}()
+	// Only let the refresh complete once Logout has closed the session
+	for {
+		session.mu.Lock()
+		closed := session.closed
+		session.mu.Unlock()
+		if closed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	if err := <-loggedOut; err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if err := <-refreshed; !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("Token = %v, want ErrSessionClosed", err)
+	}
+	want := "refresh:refresh_token,refresh-new:refresh_token,access-new:access_token"
+	if got := revokes.String(); got != want {
+		t.Fatalf("revoked = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,310 @@
+package playstation
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrTokensNotFound is an error indicating that a TokenStore holds no tokens.
+var ErrTokensNotFound = errors.New("tokens not found")
+
+// npssoHashPrefix identifies the algorithm of the hashes created by hashNPSSO.
+const npssoHashPrefix = "hmac-sha256:"
+
+// StoredSession represents what a TokenStore persists: the tokens of a session and the keyed hash of the NPSSO token
+// they were issued for. Both are saved together, so a store never holds tokens next to the hash of another NPSSO token,
+// and Authenticate only resumes the stored tokens when they were issued for the same NPSSO token.
+//
+// Fields:
+//
+//	Tokens (Tokens): The tokens of the session.
+//	NPSSOHash (string): An opaque hash of the NPSSO token the tokens were issued for, empty if there is none.
+type StoredSession struct {
+	Tokens    Tokens `json:"tokens"`
+	NPSSOHash string `json:"npsso_hash,omitempty"`
+}
+
+// TokenStore persists the session of a single account so it can be resumed after a restart.
+// Implementations must be safe for concurrent use and return ErrTokensNotFound from Load when nothing is stored.
+type TokenStore interface {
+	// Load returns the stored session, or ErrTokensNotFound if there is none.
+	Load(ctx context.Context) (*StoredSession, error)
+	// Save stores the provided session, replacing any previously stored one.
+	Save(ctx context.Context, session *StoredSession) error
+	// Delete removes the stored session. Deleting an empty store is not an error.
+	Delete(ctx context.Context) error
+}
+
+// NPSSOStore is implemented by a TokenStore that can also persist the NPSSO token of the session.
+// When the TokenStore of a Client implements it, Authenticate saves the NPSSO token and AuthenticateWithTokens
+// loads it when none is provided. The NPSSO token is a full web session credential, so it should only be
+// persisted by stores protecting it, such as EncryptedFileTokenStore.
+type NPSSOStore interface {
+	// LoadNPSSO returns the stored NPSSO token, or ErrTokensNotFound if there is none.
+	LoadNPSSO(ctx context.Context) (string, error)
+	// SaveNPSSO stores the provided NPSSO token, replacing any previously stored one.
+	SaveNPSSO(ctx context.Context, npsso string) error
+}
+
+// MemoryTokenStore is a TokenStore that keeps the session and the optional NPSSO token in memory.
+// It is mostly useful for sharing a session between several clients of the same process.
+// It implements NPSSOStore.
+type MemoryTokenStore struct {
+	mu      sync.RWMutex
+	session *StoredSession
+	npsso   string
+}
+
+// NewMemoryTokenStore creates a new empty MemoryTokenStore.
+//
+// Returns:
+//
+//	*MemoryTokenStore: A pointer to the newly created MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{}
+}
+
+// Load returns a copy of the stored session, or ErrTokensNotFound if there is none.
+func (s *MemoryTokenStore) Load(_ context.Context) (*StoredSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.session == nil {
+		return nil, ErrTokensNotFound
+	}
+	session := *s.session
+	return &session, nil
+}
+
+// Save stores a copy of the provided session.
+func (s *MemoryTokenStore) Save(_ context.Context, session *StoredSession) error {
+	if session == nil {
+		return errors.New("cannot save nil session")
+	}
+	saved := *session
+	s.mu.Lock()
+	s.session = &saved
+	s.mu.Unlock()
+	return nil
+}
+
+// LoadNPSSO returns the stored NPSSO token, or ErrTokensNotFound if there is none.
+func (s *MemoryTokenStore) LoadNPSSO(_ context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.npsso == "" {
+		return "", ErrTokensNotFound
+	}
+	return s.npsso, nil
+}
+
+// SaveNPSSO stores the provided NPSSO token.
+func (s *MemoryTokenStore) SaveNPSSO(_ context.Context, npsso string) error {
+	s.mu.Lock()
+	s.npsso = npsso
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete removes the stored session and NPSSO token.
+func (s *MemoryTokenStore) Delete(_ context.Context) error {
+	s.mu.Lock()
+	s.session = nil
+	s.npsso = ""
+	s.mu.Unlock()
+	return nil
+}
+
+// FileTokenStore is a TokenStore that keeps the tokens as JSON in a file.
+// The file is written with 0600 permissions and replaced atomically on every save, but it is not encrypted:
+// use EncryptedFileTokenStore to protect the tokens at rest.
+// It does not implement NPSSOStore, so the NPSSO token itself is never written to the file.
+type FileTokenStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// fileSession represents the content of the file of a FileTokenStore.
+// The tokens are embedded so that files written before the hash of the NPSSO token was stored remain readable.
+type fileSession struct {
+	Tokens
+	NPSSOHash string `json:"npsso_hash,omitempty"`
+}
+
+// NewFileTokenStore creates a new FileTokenStore backed by the file at the provided path.
+// The file does not need to exist yet.
+//
+// Parameters:
+//
+//	path (string): The path of the JSON file holding the tokens.
+//
+// Returns:
+//
+//	*FileTokenStore: A pointer to the newly created FileTokenStore.
+//	error: An error if the path is empty.
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	if path == "" {
+		return nil, errors.New("token store path is required")
+	}
+	return &FileTokenStore{path: path}, nil
+}
+
+// Load reads the session from the file, or returns ErrTokensNotFound if the file does not exist or holds no tokens.
+func (s *FileTokenStore) Load(_ context.Context) (*StoredSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if session.AccessToken == "" && session.RefreshToken == "" {
+		return nil, ErrTokensNotFound
+	}
+	return &StoredSession{Tokens: session.Tokens, NPSSOHash: session.NPSSOHash}, nil
+}
+
+// Save writes the session to the file and replaces the file atomically.
+func (s *FileTokenStore) Save(_ context.Context, session *StoredSession) error {
+	if session == nil {
+		return errors.New("cannot save nil session")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(&fileSession{Tokens: session.Tokens, NPSSOHash: session.NPSSOHash})
+}
+
+// Delete removes the token file.
+func (s *FileTokenStore) Delete(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing token file: %w", err)
+	}
+	return nil
+}
+
+// read reads the file. It must be called with the mutex held.
+//
+// Returns:
+//
+//	*fileSession: A pointer to the stored session.
+//	error: ErrTokensNotFound if the file does not exist, or a read error.
+func (s *FileTokenStore) read() (*fileSession, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrTokensNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file: %w", err)
+	}
+
+	var session fileSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("error parsing token file: %w", err)
+	}
+	return &session, nil
+}
+
+// write writes the session to the file, replacing it atomically. It must be called with the mutex held.
+func (s *FileTokenStore) write(session *fileSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("error encoding tokens: %w", err)
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// hashNPSSO returns a keyed hash of the NPSSO token: a random key and the HMAC-SHA256 of the NPSSO token with that key.
+// It lets a StoredSession tell which NPSSO token its tokens were issued for without holding the NPSSO token itself.
+//
+// Parameters:
+//
+//	npsso (string): The NPSSO token to be hashed.
+//
+// Returns:
+//
+//	string: The hash, to be checked with npssoHashMatches.
+//	error: An error if no random key could be generated.
+func hashNPSSO(npsso string) (string, error) {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", fmt.Errorf("error generating npsso hash key: %w", err)
+	}
+	return npssoHashPrefix + hex.EncodeToString(key) + ":" + hex.EncodeToString(npssoMAC(key, npsso)), nil
+}
+
+// npssoHashMatches reports whether the hash created by hashNPSSO is the hash of the NPSSO token.
+func npssoHashMatches(hash string, npsso string) bool {
+	encodedKey, encodedMAC, ok := strings.Cut(strings.TrimPrefix(hash, npssoHashPrefix), ":")
+	if !ok || !strings.HasPrefix(hash, npssoHashPrefix) {
+		return false
+	}
+	key, err := hex.DecodeString(encodedKey)
+	if err != nil {
+		return false
+	}
+	mac, err := hex.DecodeString(encodedMAC)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, npssoMAC(key, npsso))
+}
+
+// npssoMAC returns the HMAC-SHA256 of the NPSSO token with the provided key.
+func npssoMAC(key []byte, npsso string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(npsso))
+	return mac.Sum(nil)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it over path,
+// so readers never observe a partially written file.
+//
+// Parameters:
+//
+//	path (string): The path of the file to write.
+//	data ([]byte): The content of the file.
+//
+// Returns:
+//
+//	error: An error indicating whether the file was written or not.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error setting file permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing temporary file: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("error replacing file: %w", err)
+	}
+	return nil
+}
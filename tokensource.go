@@ -0,0 +1,204 @@
+package playstation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TokenSource is the interface implemented by anything able to provide a valid PSN access token.
+// ClientAPI implements it, refreshing the session tokens as needed.
+type TokenSource interface {
+	// Token returns a valid access token.
+	Token(ctx context.Context) (string, error)
+}
+
+// Token returns a valid access token for the session, refreshing the tokens first if the current one has expired.
+// It implements the TokenSource interface.
+//
+// Parameters:
+//
+//	ctx (context.Context): The context for controlling the refresh lifetime.
+//
+// Returns:
+//
+//	string: A valid access token.
+//	error: An error indicating whether a valid access token could be obtained or not.
+func (c *ClientAPI) Token(ctx context.Context) (string, error) {
+	return c.accessToken(ctx)
+}
+
+// Transport is an http.RoundTripper that authorizes every request with a token from a TokenSource,
+// setting the same headers as the requests made by ClientAPI.
+// When Hosts is set, requests to other hosts, for example after a redirect, are sent without the access token.
+//
+// Fields:
+//
+//	Source (TokenSource): The source of the access tokens, required.
+//	Language (Language): The language sent in the Accept-Language header, if not empty.
+//	Base (http.RoundTripper): The transport used to send the requests, http.DefaultTransport if nil.
+//	Hosts ([]string): The hosts, with their port if any, the access token is sent to, every host if empty.
+type Transport struct {
+	Source   TokenSource
+	Language Language
+	Base     http.RoundTripper
+	Hosts    []string
+}
+
+// RoundTrip authorizes the request and sends it with the base transport.
+// Requests to a host that is not listed in Hosts are sent as is. The original request is not modified.
+//
+// Parameters:
+//
+//	req (*http.Request): The request to be sent.
+//
+// Returns:
+//
+//	*http.Response: The response returned by the base transport.
+//	error: An error indicating whether the request could be authorized and sent or not.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !t.authorizes(req.URL.Host) {
+		return base.RoundTrip(req)
+	}
+
+	if t.Source == nil {
+		closeRequestBody(req)
+		return nil, fmt.Errorf("transport has no token source")
+	}
+	accessToken, err := t.Source.Token(req.Context())
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	authReq := req.Clone(req.Context())
+	setAuthHeaders(authReq, accessToken, t.Language)
+	return base.RoundTrip(authReq)
+}
+
+// authorizes reports whether the access token is sent to the host.
+func (t *Transport) authorizes(host string) bool {
+	if len(t.Hosts) == 0 {
+		return true
+	}
+	for _, allowed := range t.Hosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Transport returns a Transport authorizing requests with the tokens of the session.
+// The access token is only sent to the hosts of the PSN API endpoints of the Client.
+// If base is nil, requests are sent like those of the Client: through its rate limiter, middlewares,
+// logger and metrics, with its HTTP client. Their operation is "HTTPClient" unless their context already carries one.
+//
+// Parameters:
+//
+//	base (http.RoundTripper): The transport used to send the requests, may be nil.
+//
+// Returns:
+//
+//	*Transport: A pointer to the Transport using the session as its TokenSource.
+func (c *ClientAPI) Transport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = clientTransport{client: c.Client}
+	}
+	return &Transport{
+		Source:   c,
+		Language: c.Client.lang,
+		Base:     base,
+		Hosts:    c.Client.endpoints.apiHosts(),
+	}
+}
+
+// HTTPClient returns an HTTP client whose requests are authorized with the tokens of the session.
+// It can be used to call PSN endpoints that are not wrapped by this package, and shares the rate limiter,
+// middlewares, logger and metrics of the Client. Like Transport, it only sends the access token to the hosts
+// of the PSN API endpoints, so redirects to other hosts never receive it.
+//
+// Returns:
+//
+//	*http.Client: A pointer to the authorized HTTP client.
+func (c *ClientAPI) HTTPClient() *http.Client {
+	return &http.Client{
+		Transport: c.Transport(nil),
+		Timeout:   c.Client.httpClient.Timeout,
+	}
+}
+
+// clientTransport is an http.RoundTripper sending requests the way the Client does,
+// through its rate limiter, middlewares, logger and metrics.
+//
+// Fields:
+//
+//	client (*Client): The Client sending the requests.
+type clientTransport struct {
+	client *Client
+}
+
+// RoundTrip sends the request with the Client.
+//
+// Parameters:
+//
+//	req (*http.Request): The request to be sent.
+//
+// Returns:
+//
+//	*http.Response: The response to the request.
+//	error: An error indicating whether the request was sent or not.
+func (t clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Operation(req.Context()) == "" {
+		req = req.WithContext(withOperation(req.Context(), "HTTPClient"))
+	}
+	resp, err := t.client.do(req)
+	if err != nil {
+		// The rate limiter may fail before the request reaches the HTTP client, which would close the body
+		closeRequestBody(req)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// apiHosts returns the hosts of the PSN API endpoints, to which access tokens are sent.
+// The host of the Sony OAuth server is not one of them.
+func (e Endpoints) apiHosts() []string {
+	var hosts []string
+	for _, endpoint := range []string{e.LegacyProfile, e.MobileAPI, e.GraphQL} {
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			hosts = append(hosts, u.Host)
+		}
+	}
+	return hosts
+}
+
+// setAuthHeaders sets the headers required to call the PlayStation API on the request.
+//
+// Parameters:
+//
+//	req (*http.Request): The request to be authorized.
+//	accessToken (string): The access token sent as a Bearer token.
+//	lang (Language): The language sent in the Accept-Language header, if not empty.
+func setAuthHeaders(req *http.Request, accessToken string, lang Language) {
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	if lang != "" && req.Header.Get("Accept-Language") == "" {
+		req.Header.Set("Accept-Language", string(lang))
+	}
+}
+
+// closeRequestBody closes the body of a request that will not be sent, as required from an http.RoundTripper.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,41 @@
+package playstation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestHTTPClientKeepsTokenOnPSNHosts(t *testing.T) {
+	var mu sync.Mutex
+	var psnAuthorization, otherAuthorization string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		otherAuthorization = r.Header.Get("Authorization")
+		mu.Unlock()
+	}))
+	t.Cleanup(other.Close)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		psnAuthorization = r.Header.Get("Authorization")
+		mu.Unlock()
+		http.Redirect(w, r, other.URL+"/elsewhere", http.StatusFound)
+	}))
+	session := newTestSession(t, client, testTokens(true))
+
+	resp, err := session.HTTPClient().Get(client.Endpoints().MobileAPI + "/redirected")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if psnAuthorization != "Bearer access" {
+		t.Fatalf("Authorization sent to PSN = %q, want Bearer access", psnAuthorization)
+	}
+	if otherAuthorization != "" {
+		t.Fatalf("Authorization sent to the redirect host = %q, want none", otherAuthorization)
+	}
+}
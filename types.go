@@ -1,7 +1,10 @@
 package playstation
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -17,10 +20,65 @@ type Options func(c *Client)
 //	httpClient (*http.Client): The HTTP client used for making requests.
 //	lang (Language): The language used for the client.
 //	region (Region): The region used for the client.
+//	store (TokenStore): The optional store used to persist the session tokens.
+//	storeMu (*sync.Mutex): The mutex making the sequences of store accesses of the sessions atomic.
+//	oauth (OAuthConfig): The OAuth client parameters used for authentication.
+//	retry (RetryPolicy): The policy used to retry failed API requests, no retries by default.
+//	limiter (*hostLimiter): The optional rate limiter throttling requests per host.
+//	endpoints (Endpoints): The base URLs of the PSN services.
+//	middlewares ([]Middleware): The middlewares wrapping every request.
+//	roundTrip (RoundTripFunc): The HTTP client wrapped by the middlewares.
+//	logger (*slog.Logger): The optional logger requests are logged to.
+//	metrics (Metrics): The optional recorder of request and authentication metrics.
+//	cache (Cache): The optional cache of the responses of GET requests.
+//	cachePolicy (CachePolicy): The TTL of the cached responses of each operation.
 type Client struct {
-	httpClient *http.Client
-	lang       Language
-	region     Region
+	httpClient  *http.Client
+	lang        Language
+	region      Region
+	store       TokenStore
+	storeMu     *sync.Mutex
+	oauth       OAuthConfig
+	retry       RetryPolicy
+	limiter     *hostLimiter
+	endpoints   Endpoints
+	middlewares []Middleware
+	roundTrip   RoundTripFunc
+	logger      *slog.Logger
+	metrics     Metrics
+	cache       Cache
+	cachePolicy CachePolicy
+}
+
+// Endpoints represents the base URLs of the PSN services, without trailing slash.
+// They can be pointed at a local stand-in server or a caching proxy.
+//
+// Fields:
+//
+//	Auth (string): The base URL of the Sony OAuth server, holding the authorize, token and revoke endpoints.
+//	LegacyProfile (string): The base URL of the legacy profile service.
+//	MobileAPI (string): The base URL of the mobile API.
+//	GraphQL (string): The URL of the GraphQL API.
+type Endpoints struct {
+	Auth          string
+	LegacyProfile string
+	MobileAPI     string
+	GraphQL       string
+}
+
+// OAuthConfig represents the OAuth client parameters used to authenticate against the Sony account server.
+//
+// Fields:
+//
+//	ClientID (string): The OAuth client ID.
+//	ClientSecret (string): The OAuth client secret, sent with the client ID as Basic authentication.
+//	Scopes ([]string): The scopes requested for the tokens.
+//	RedirectURI (string): The redirect URI registered for the client.
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURI  string
 }
 
 // Tokens represents the authentication tokens used for accessing the PlayStation API.
@@ -42,16 +100,45 @@ type Tokens struct {
 }
 
 // ClientAPI represents a client for interacting with the PlayStation API that includes authentication tokens and NPSSO.
+// It is safe for concurrent use: when the access token expires, a single refresh is performed and shared by all callers,
+// and identical GET requests made at the same time are sent once and share their response.
+// Once the ClientAPI is shared between goroutines, use CurrentTokens instead of reading the Tokens field.
 //
 // Fields:
 //
 //	Client (*Client): The embedded client for interacting with the PlayStation API.
 //	Tokens (*Tokens): The authentication tokens used for accessing the API.
-//	NPSSO (string): The NPSSO token used for authentication.
+//	NPSSO (string): The NPSSO token used for authentication, empty for sessions resumed without one.
+//	mu (sync.Mutex): The mutex guarding Tokens, NPSSO, the refresh in flight, the session state and the hooks.
+//	refreshing (*refreshCall): The refresh in flight, nil if there is none.
+//	closed (bool): Whether the session has been closed with Logout.
+//	stopAutoRefresh (context.CancelFunc): Stops the background refresher started by StartAutoRefresh, nil if none is running.
+//	hooks (sessionHooks): The lifecycle callbacks registered on the session.
+//	flights (flightGroup): The GET requests in flight, shared by identical concurrent requests.
+//	refreshWaitHook (func()): Called when a caller starts waiting for a refresh performed by another caller, may be nil.
 type ClientAPI struct {
 	Client *Client
 	Tokens *Tokens
 	NPSSO  string
+
+	mu              sync.Mutex
+	refreshing      *refreshCall
+	closed          bool
+	stopAutoRefresh context.CancelFunc
+	hooks           sessionHooks
+	flights         flightGroup
+	refreshWaitHook func()
+}
+
+// SessionInfo represents the account a session is authenticated as.
+//
+// Fields:
+//
+//	AccountID (string): The account ID of the authenticated user.
+//	OnlineID (string): The online ID of the authenticated user.
+type SessionInfo struct {
+	AccountID string
+	OnlineID  string
 }
 
 type UserAccountResponse struct {